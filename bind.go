@@ -0,0 +1,313 @@
+package bootloader
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// BindError reports the keys that could not be bound into a struct.
+type BindError struct {
+	Prefix  string
+	Missing []string
+	Invalid []string
+}
+
+func (e *BindError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "bootloader: bind properties %s", e.Prefix)
+	if len(e.Missing) > 0 {
+		fmt.Fprintf(&b, ", missing: %s", strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		fmt.Fprintf(&b, ", invalid: %s", strings.Join(e.Invalid, "; "))
+	}
+	return b.String()
+}
+
+func (e *BindError) empty() bool {
+	return len(e.Missing) == 0 && len(e.Invalid) == 0
+}
+
+// fieldKey returns the property key of a struct field and its tag
+// options, honoring the bloader, json and yaml tags in that order.
+// skip is set for fields tagged "-".
+func fieldKey(sf reflect.StructField) (key string, opts map[string]string, skip bool) {
+	for _, name := range []string{structTag, "json", "yaml"} {
+		tag, ok := sf.Tag.Lookup(name)
+		if !ok {
+			continue
+		}
+		key, opts = parseTag(tag)
+		if key == "-" {
+			return "", nil, true
+		}
+		if key != "" {
+			return strings.ToLower(key), opts, false
+		}
+		break
+	}
+	return strings.ToLower(sf.Name), opts, false
+}
+
+// squashed reports whether the options of a struct field tag lift the
+// keys of the field into its parent, as with ",squash" or ",inline".
+func squashed(opts map[string]string) bool {
+	return opts["squash"] == "true" || opts["inline"] == "true"
+}
+
+// bindable reports whether t is populated key by key rather than
+// converted from a single value.
+func bindable(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return !reflect.PtrTo(t).Implements(textUnmarshalerType)
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String
+	case reflect.Slice, reflect.Array:
+		return bindable(t.Elem())
+	}
+	return false
+}
+
+// has reports whether a property exists at or below prefix.
+func (p *properties) has(prefix string) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.exists(prefix)
+}
+
+func (p *properties) exists(prefix string) bool {
+	return p.raw(prefix) != zero || len(p.children(prefix)) > 0
+}
+
+// children returns the sorted names of the keys directly below prefix.
+func (p *properties) children(prefix string) []string {
+	dot := strings.ToLower(prefix) + "."
+	seen := make(map[string]struct{})
+	var names []string
+	for _, key := range p.keys() {
+		if !strings.HasPrefix(key, dot) {
+			continue
+		}
+		if _, s := p.find(key); s == nil {
+			continue
+		}
+		name := key[len(dot):]
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nested reports whether key holds a map, a struct or a slice whose
+// keys may come from several sources, rather than a single value.
+func (p *properties) nested(key string) bool {
+	v := p.raw(key)
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid, reflect.Map, reflect.Array:
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return false
+		}
+	case reflect.Struct:
+		if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+			return false
+		}
+	default:
+		return false
+	}
+	return len(p.children(key)) > 0
+}
+
+// tree merges the properties below key from every source into a
+// map[string]interface{}, or into a []interface{} if key holds a slice.
+func (p *properties) tree(key string, e *BindError) reflect.Value {
+	var v reflect.Value
+	if p.raw(key+"."+propertyLengthKey) != zero {
+		v = reflect.New(reflect.TypeOf([]interface{}(nil))).Elem()
+	} else {
+		v = reflect.New(reflect.TypeOf(map[string]interface{}(nil))).Elem()
+	}
+	p.bindValue(key, v, false, e)
+	return v
+}
+
+// merged resolves name like lookup, merging the properties below name
+// from every source if it holds a nested value.
+func (p *properties) merged(name string) (reflect.Value, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	key := strings.ToLower(name)
+	if !p.nested(key) {
+		return p.resolve(name, nil)
+	}
+	e := &BindError{Prefix: name}
+	v := p.tree(key, e)
+	if !e.empty() {
+		return zero, e
+	}
+	return v, nil
+}
+
+// bind populates a copy of current from the properties below prefix;
+// the values missing from the properties are kept.
+func (p *properties) bind(prefix string, current reflect.Value) (reflect.Value, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	e := &BindError{Prefix: prefix}
+	v := reflect.New(current.Type()).Elem()
+	v.Set(current)
+	p.bindValue(strings.ToLower(prefix), v, false, e)
+	if !e.empty() {
+		return zero, e
+	}
+	return v, nil
+}
+
+func (p *properties) bindValue(key string, v reflect.Value, optional bool, e *BindError) {
+	t := v.Type()
+	if t.Kind() != reflect.Struct && bindable(t) && !p.exists(key) {
+		if !optional {
+			e.Missing = append(e.Missing, key)
+		}
+		return
+	}
+	if t.Kind() == reflect.Ptr && bindable(t) {
+		ptr := reflect.New(t.Elem())
+		if !v.IsNil() {
+			ptr.Elem().Set(v.Elem())
+		}
+		p.bindValue(key, ptr.Elem(), optional, e)
+		v.Set(ptr)
+		return
+	}
+	if t == emptyInterfaceType && p.nested(key) {
+		v.Set(p.tree(key, e))
+		return
+	}
+	if !bindable(t) {
+		prop, err := p.resolve(key, nil)
+		if err != nil {
+			e.Invalid = append(e.Invalid, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		if prop == zero && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && p.exists(key) {
+			p.bindSlice(key, v, e)
+			return
+		}
+		if prop == zero {
+			if !optional {
+				e.Missing = append(e.Missing, key)
+			}
+			return
+		}
+		cv, err := convert(prop, t)
+		if err != nil {
+			e.Invalid = append(e.Invalid, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		v.Set(cv)
+		return
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		p.bindSlice(key, v, e)
+		return
+	}
+	if t.Kind() == reflect.Map {
+		m := reflect.MakeMap(t)
+		for _, name := range p.children(key) {
+			ev := reflect.New(t.Elem()).Elem()
+			p.bindValue(key+"."+name, ev, false, e)
+			m.SetMapIndex(reflect.ValueOf(name).Convert(t.Key()), ev)
+		}
+		v.Set(m)
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, opts, skip := fieldKey(sf)
+		if skip || sf.PkgPath != "" && !(sf.Anonymous && squashed(opts)) {
+			continue
+		}
+		fieldOptional := optional || opts[structTagOptional] == "true" || opts["omitempty"] == "true"
+		if squashed(opts) {
+			p.bindValue(key, v.Field(i), fieldOptional, e)
+		} else if key == "" {
+			p.bindValue(name, v.Field(i), fieldOptional, e)
+		} else {
+			p.bindValue(key+"."+name, v.Field(i), fieldOptional, e)
+		}
+	}
+}
+
+// bindSlice populates a slice or an array from the indexed keys below
+// key. The length key, if any, wins over the indexes found, so that a
+// source overriding a longer slice of a lower source shortens it.
+func (p *properties) bindSlice(key string, v reflect.Value, e *BindError) {
+	n := -1
+	if prop := p.raw(key + "." + propertyLengthKey); prop != zero {
+		length, err := convert(prop, reflect.TypeOf(n))
+		if err != nil || length.Int() < 0 {
+			e.Invalid = append(e.Invalid, fmt.Sprintf("%s.%s: bad length %v", key, propertyLengthKey, prop.Interface()))
+			return
+		}
+		n = int(length.Int())
+	} else {
+		for _, name := range p.children(key) {
+			if i, err := strconv.Atoi(name); err == nil && i >= n {
+				n = i + 1
+			}
+		}
+	}
+	if n < 0 {
+		n = 0
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Array {
+		if n > t.Len() {
+			e.Invalid = append(e.Invalid, fmt.Sprintf("%s: %d items for %s", key, n, t))
+			return
+		}
+	} else {
+		v.Set(reflect.MakeSlice(t, n, n))
+	}
+	for i := 0; i < n; i++ {
+		p.bindValue(key+"."+strconv.Itoa(i), v.Index(i), false, e)
+	}
+}
+
+// BindProperties populates the struct pointed to by out from the
+// properties below prefix. Field names match keys case-insensitively
+// and may be renamed with the bloader, json or yaml tag; fields tagged
+// optional or omitempty may be missing, keeping the values preset in
+// out. Slices and arrays are bound from indexed keys such as
+// servers.0.host.
+func (loader *bootloader) BindProperties(prefix string, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bootloader: BindProperties expects a non-nil pointer, got %T", out)
+	}
+	v, err := loader.props.bind(prefix, rv.Elem())
+	if err != nil {
+		return err
+	}
+	rv.Elem().Set(v)
+	return nil
+}
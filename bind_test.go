@@ -0,0 +1,160 @@
+package bootloader
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type dbConfig struct {
+	Host     string
+	Port     int
+	MaxConns int           `json:"max_conns"`
+	Timeout  time.Duration `bloader:"timeout,optional"`
+	Replica  *dbConfig     `json:",omitempty"`
+	Ignored  string        `json:"-"`
+	Labels   map[string]string
+}
+
+type repository struct {
+	DB dbConfig `bloader:"$db"`
+}
+
+func Test_BindProperties(t *testing.T) {
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"db": map[string]interface{}{
+			"HOST":      "localhost",
+			"port":      "5432",
+			"max_conns": 10,
+			"ignored":   "x",
+			"labels":    map[string]string{"env": "dev"},
+		},
+	})
+	var cfg dbConfig
+	if err := loader.BindProperties("db", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "localhost" || cfg.Port != 5432 || cfg.MaxConns != 10 || cfg.Ignored != "" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg.Labels["env"] != "dev" {
+		t.Errorf("unexpected labels %v", cfg.Labels)
+	}
+
+	repo := &repository{}
+	loader.AddByAuto(repo)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if repo.DB.Port != 5432 {
+		t.Errorf("unexpected injected config %+v", repo.DB)
+	}
+}
+
+func Test_BindProperties_Defaults(t *testing.T) {
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"db": map[string]interface{}{"host": "localhost"},
+	})
+	cfg := struct {
+		Host    string
+		Port    int           `bloader:"port,optional"`
+		Timeout time.Duration `bloader:"timeout,optional"`
+		Replica *dbConfig     `json:",omitempty"`
+	}{Host: "default", Port: 5432, Timeout: time.Second}
+	if err := loader.BindProperties("db", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "localhost" || cfg.Port != 5432 || cfg.Timeout != time.Second || cfg.Replica != nil {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func Test_BindProperties_Errors(t *testing.T) {
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"port": "http",
+		},
+	})
+	var cfg dbConfig
+	err := loader.BindProperties("db", &cfg)
+	var berr *BindError
+	if !errors.As(err, &berr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(berr.Missing) != 2 || berr.Missing[0] != "db.max_conns" || berr.Missing[1] != "db.labels" {
+		t.Errorf("unexpected missing keys %v", berr.Missing)
+	}
+	if len(berr.Invalid) != 1 {
+		t.Errorf("unexpected invalid keys %v", berr.Invalid)
+	}
+}
+
+type serverConfig struct {
+	Host string
+	Port int
+}
+
+type cluster struct {
+	Servers []serverConfig `bloader:"$servers"`
+	Primary string         `bloader:"$servers.0.host"`
+	Count   int            `bloader:"$servers.length"`
+}
+
+func Test_BindProperties_Slices(t *testing.T) {
+	os.Setenv("BLSLICE_TAGS_0", "a")
+	os.Setenv("BLSLICE_TAGS_1", "b")
+	defer os.Unsetenv("BLSLICE_TAGS_0")
+	defer os.Unsetenv("BLSLICE_TAGS_1")
+
+	loader := newBootloader()
+	loader.AddPropertySource(SourceDefaults, PriorityDefaults, map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"host": "a", "port": 1},
+			map[string]interface{}{"host": "b", "port": 2},
+			map[string]interface{}{"host": "c", "port": 3},
+		},
+	}, MergeDeep)
+	if v, _ := loader.GetProperty("servers.1.host"); v != "b" {
+		t.Errorf("unexpected servers.1.host %v", v)
+	}
+	if v, _ := loader.GetProperty("servers.length"); v != 3 {
+		t.Errorf("unexpected servers.length %v", v)
+	}
+
+	// A higher source with a shorter slice overrides the length.
+	loader.SetProperties(map[string]interface{}{
+		"servers": []serverConfig{{Host: "x", Port: 10}, {Host: "y"}},
+	})
+	c := &cluster{}
+	loader.AddByAuto(c)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Servers) != 2 || c.Servers[0] != (serverConfig{"x", 10}) || c.Servers[1] != (serverConfig{"y", 0}) {
+		t.Errorf("unexpected servers %+v", c.Servers)
+	}
+	if c.Primary != "x" || c.Count != 2 {
+		t.Errorf("unexpected cluster %+v", c)
+	}
+
+	loader.EnableEnv("BLSLICE", "")
+	var cfg struct {
+		Tags  []string
+		Pairs [2]serverConfig `bloader:"servers"`
+	}
+	if err := loader.BindProperties("", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Tags) != 2 || cfg.Tags[1] != "b" || cfg.Pairs[1].Host != "y" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	var small [1]serverConfig
+	if err := loader.BindProperties("servers", &small); err == nil {
+		t.Errorf("expected an error for a short array")
+	}
+}
@@ -2,10 +2,15 @@ package bootloader
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -27,6 +32,10 @@ const (
 	structTag        = "bloader"
 	structTagAutoVal = "auto"
 	maxDeep          = 5
+
+	structTagQualifier = "qualifier"
+	structTagOptional  = "optional"
+	structTagStatic    = "static"
 )
 
 var (
@@ -40,7 +49,10 @@ func newBootloader() Bootloader {
 	loader.log.Show(envBLoaderLogEnabled)
 	ctx := context.Background()
 	ctx, loader.cancel = context.WithCancel(context.Background())
-	loader.errg, _ = errgroup.WithContext(ctx)
+	loader.errg, loader.ctx = errgroup.WithContext(ctx)
+	loader.subs = newSubscribers(loader.log)
+	loader.timeouts = newTimeouts()
+	loader.timeouts.set(PhaseHealthCheck, defaultHealthCheckTimeout)
 	loader.props = newProperties(propNamePrefix)
 	loader.g = newGroup(loader.OnBeforeAdding,
 		loader.OnAfterAdded)
@@ -54,29 +66,59 @@ func newBootloader() Bootloader {
 
 type Bootloader interface {
 	Get(name string) (interface{}, error)
-	Add(name string, x interface{}) error
-	AddFromType(x interface{}) error
-	AddByAuto(x interface{}) error
+	Add(name string, x interface{}, opts ...Option) error
+	AddFromType(x interface{}, opts ...Option) error
+	AddByAuto(x interface{}, opts ...Option) error
 	SetIgnores(name ...string) error
 	SetProperties(data interface{}) error
+	AddPropertySource(name string, priority int, data interface{}, merge MergeStrategy) error
+	PropertySource(key string) (string, bool)
 	GetProperty(name string) (interface{}, bool)
 	MuestGetProperty(name string) interface{}
+	SetExpandEnv(enabled bool)
+	EnableEnv(prefix, separator string)
+	RegisterFlags(fs *flag.FlagSet)
+	ParseFlags(fs *flag.FlagSet, args []string) error
+	BindProperties(prefix string, out interface{}) error
+	LoadProperties(path string) error
+	ReloadProperties() error
+	WatchProperties(interval time.Duration)
+	PropertyLock() sync.Locker
 	Launch() error
+	LaunchWithSignals(sig ...os.Signal) error
+	Reload() error
 	TestUnit(fn func() error) error
 	AssertNil(t *testing.T, fn func() error)
 	Run() error
 	Wait() error
 	Shutdown() error
+	SetTimeout(phase Phase, d time.Duration)
+	SetShutdownTimeout(d time.Duration)
+	Health(ctx context.Context) HealthReport
+	Subscribe(fn func(Event)) (unsubscribe func())
+	Modules() []ModuleInfo
+	Provide(fn interface{}, opts ...Option) error
 	ShowLog(bool)
 }
 
 type bootloader struct {
+	ctx    context.Context
 	cancel context.CancelFunc
 	errg   *errgroup.Group
 	props  *properties
 	g      *group
 	h      *injectionHandler
 	log    Logger
+
+	timeouts        *timeouts
+	shutdownTimeout int64
+	subs            *subscribers
+
+	providers      []*provider
+	providersMutex sync.Mutex
+
+	reloadMutex sync.Mutex
+	fieldsMutex sync.RWMutex
 }
 
 func (loader *bootloader) Get(name string) (interface{}, error) {
@@ -121,31 +163,48 @@ func (loader *bootloader) extractModuler(x interface{}, deep int) (interface{},
 	return x, nil
 }
 
-func (loader *bootloader) AddFromType(x interface{}) error {
-	return loader.AddByAuto(x)
-}
-
-func (loader *bootloader) AddByAuto(x interface{}) error {
+func (loader *bootloader) wrap(x interface{}, opts []Option) *wrappedModule {
 	m, err := loader.extractModuler(x, maxDeep)
 	if err != nil {
 		panic(err)
 	}
 	wrapped := newWrappedModule(m)
+	wrapped.opts = newOptions(opts)
+	wrapped.timeouts = loader.timeouts
+	wrapped.events = loader.subs.Publish
+	wrapped.shutdown = loader.shutdownContext
 	wrapped.log = loader.log
-	if loader.g.AddByType(wrapped) {
-		loader.h.Inject(wrapped)
-	}
-	return nil
+	return wrapped
 }
 
-func (loader *bootloader) Add(name string, x interface{}) error {
-	m, err := loader.extractModuler(x, maxDeep)
+func (loader *bootloader) AddFromType(x interface{}, opts ...Option) error {
+	return loader.AddByAuto(x, opts...)
+}
+
+func (loader *bootloader) AddByAuto(x interface{}, opts ...Option) error {
+	return loader.add("", loader.wrap(x, opts))
+}
+
+func (loader *bootloader) Add(name string, x interface{}, opts ...Option) error {
+	return loader.add(name, loader.wrap(x, opts))
+}
+
+// add registers wrapped by name, or by type if name is empty.
+func (loader *bootloader) add(name string, wrapped *wrappedModule) error {
+	var (
+		added bool
+		err   error
+	)
+	if name == "" {
+		added, err = loader.g.AddByType(wrapped)
+	} else {
+		wrapped.name = name
+		added, err = loader.g.AddByName(name, wrapped)
+	}
 	if err != nil {
-		panic(err)
+		return loader.fail(err)
 	}
-	wrapped := newWrappedModule(m)
-	wrapped.log = loader.log
-	if loader.g.AddByName(name, wrapped) {
+	if added {
 		loader.h.Inject(wrapped)
 	}
 	return nil
@@ -155,47 +214,119 @@ func (loader *bootloader) SetIgnores(name ...string) error {
 	return loader.g.SetIgnores(name...)
 }
 
+// SetProperties merges the properties of data into the programmatic
+// source.
 func (loader *bootloader) SetProperties(data interface{}) error {
 	loader.props.set(data)
 	return nil
 }
 
+// AddPropertySource adds the properties of data as the source name, or
+// replaces the source if it exists. See PriorityFiles and the related
+// constants for the priorities of the built-in sources.
+func (loader *bootloader) AddPropertySource(name string, priority int, data interface{}, merge MergeStrategy) error {
+	if name == "" {
+		return fmt.Errorf("bootloader: property source without a name")
+	}
+	if v := indirect(data); v.IsValid() && v.Kind() != reflect.Struct && v.Kind() != reflect.Map {
+		return fmt.Errorf("bootloader: property source %s, unsupported type %s", name, v.Type())
+	}
+	loader.props.add(name, priority, merge, data)
+	return nil
+}
+
+// PropertySource returns the name of the source supplying the
+// effective value of the property key.
+func (loader *bootloader) PropertySource(key string) (string, bool) {
+	return loader.props.origin(key)
+}
+
+// GetProperty returns the value of the property name, with the
+// placeholders of string values expanded. A nested value merges the
+// keys of every source into a map[string]interface{}.
 func (loader *bootloader) GetProperty(name string) (interface{}, bool) {
-	if prop := loader.props.value(name); prop != zero {
+	if prop, err := loader.props.merged(name); err == nil && prop != zero {
 		return prop.Interface(), true
 	}
 	return nil, false
 }
 
 func (loader *bootloader) MuestGetProperty(name string) interface{} {
-	if i, ok := loader.GetProperty(name); ok {
-		return i
+	prop, err := loader.props.merged(name)
+	if err != nil {
+		panic(err)
+	}
+	if prop == zero {
+		panic(fmt.Errorf("bootloader: property %s not found", name))
 	}
-	panic(fmt.Errorf("bootloader: property %s not found", name))
+	return prop.Interface()
+}
+
+// EnableEnv overlays the environment on the properties: with the prefix
+// APP and the separator "_", APP_DB_USERNAME overrides db.username.
+// An empty separator defaults to "_".
+func (loader *bootloader) EnableEnv(prefix, separator string) {
+	loader.props.setEnv(prefix, separator)
+}
+
+// SetExpandEnv lets property placeholders fall back to
+// environment variables.
+func (loader *bootloader) SetExpandEnv(enabled bool) {
+	loader.props.setExpandEnv(enabled)
+}
+
+// SetTimeout sets the default timeout of phase for every module.
+// A zero duration, the default, disables the timeout.
+func (loader *bootloader) SetTimeout(phase Phase, d time.Duration) {
+	loader.timeouts.set(phase, d)
+}
+
+// SetShutdownTimeout bounds the time Wait spends stopping and destroying
+// the modules once the shutdown has begun.
+func (loader *bootloader) SetShutdownTimeout(d time.Duration) {
+	atomic.StoreInt64(&loader.shutdownTimeout, int64(d))
 }
 
 func (loader *bootloader) ShowLog(b bool) {
 	loader.log.Show(b)
 }
 
-func (loader *bootloader) OnBeforeAdding(m *wrappedModule) {
-	m.Create()
+func (loader *bootloader) OnBeforeAdding(m *wrappedModule) error {
+	if err := loader.h.Check(m); err != nil {
+		return err
+	}
+	return m.Create(loader.ctx)
 }
 
 func (loader *bootloader) OnAfterAdded(m *wrappedModule) {
 	if len(m.Fields()) <= 0 {
 		loader.doMount(m)
-		return
+	} else {
+		loader.h.Inject(m)
 	}
-	loader.h.Inject(m)
+	// m may complete the parameters of a pending provider
+	loader.provide()
 }
 
 func (loader *bootloader) doMount(m *wrappedModule) {
-	m.Mount()
+	if err := m.Mount(loader.ctx); err != nil {
+		loader.fail(err)
+		return
+	}
+	atomic.StoreInt32(&m.supervised, 1)
+	loader.errg.Go(func() error {
+		defer close(m.superviseDone)
+		return loader.supervise(m)
+	})
+}
+
+// fail records err in the errgroup so that Wait reports it and
+// the context handed to the other modules is cancelled.
+func (loader *bootloader) fail(err error) error {
 	loader.errg.Go(func() error {
-		m.Start()
-		return nil
+		return err
 	})
+	return err
 }
 
 func (loader *bootloader) OnInjectCompleted(m *wrappedModule) {
@@ -207,8 +338,8 @@ func (loader *bootloader) OnBeforeInjectFieldHook(m *wrappedModule, f *wrappedFi
 }
 
 func (loader *bootloader) OnAfterInjectFieldHook(m *wrappedModule, f *wrappedField) {
-	tag := f.tag
-	if len(tag) > 0 && tag[0] == '$' {
+	key := f.key
+	if len(key) > 0 && key[0] == '$' {
 		loader.injectProperty(m, f)
 	}
 }
@@ -219,25 +350,75 @@ func (loader *bootloader) injectProperty(m *wrappedModule, f *wrappedField) {
 			panic(fmt.Errorf("bootloader: Module %s, FiledName:%s, %v", m.Path(), f.name, err))
 		}
 	}()
-	shell, _ := getShellName(f.tag[1:])
-	props := loader.props
-	if props == nil {
+	if loader.props == nil {
 		panic(fmt.Errorf("bootloader: props not set"))
 	}
-	if prop := props.value(shell); prop != zero {
-		f.SetValue(prop)
+	v, err := loader.propertyValue(f)
+	if err != nil {
+		panic(err)
+	}
+	if v != zero {
+		f.SetValue(v)
 		loader.log.Println("bootloader: setprop", m.Path(), "FieldName:", f.name)
 	}
 }
 
+// propertyValue returns the value of the property of f converted to
+// the type of f, or bound into it for structs and maps. The value is
+// invalid if the property is missing and has no default.
+func (loader *bootloader) propertyValue(f *wrappedField) (reflect.Value, error) {
+	props := loader.props
+	name, def, hasDef := parsePropertyKey(f.key[1:])
+	if bindable(f.rt) && props.has(name) {
+		return props.bind(name, f.rv)
+	}
+	prop, err := props.merged(name)
+	if err != nil {
+		return zero, err
+	}
+	if prop == zero && hasDef {
+		prop = reflect.ValueOf(def)
+	}
+	if prop == zero {
+		return zero, nil
+	}
+	v, err := convert(prop, f.rt)
+	if err != nil {
+		return zero, fmt.Errorf("property %s, %v", name, err)
+	}
+	return v, nil
+}
+
+// Launch runs the container and waits for it while trapping DefaultSignals.
 func (loader *bootloader) Launch() (err error) {
+	return loader.LaunchWithSignals(DefaultSignals...)
+}
+
+// LaunchWithSignals runs the container and waits for it while trapping sig.
+func (loader *bootloader) LaunchWithSignals(sig ...os.Signal) (err error) {
 	err = loader.Run()
 	if err != nil {
 		return
 	}
+	stop := loader.handleSignals(sig...)
+	defer stop()
 	return loader.Wait()
 }
 
+// Reload runs the reload hook of every running module, dependencies first,
+// and returns the first error.
+func (loader *bootloader) Reload() (err error) {
+	for _, m := range loader.g.DependencyOrder() {
+		if rerr := m.Reload(loader.ctx); rerr != nil {
+			loader.log.Println(rerr)
+			if err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
 func (loader *bootloader) TestUnit(fn func() error) (err error) {
 	return loader.run(fn)
 }
@@ -253,6 +434,7 @@ func (loader *bootloader) run(fn func() error) (err error) {
 
 	// verify all module
 	loader.h.Verify()
+	loader.verifyProviders()
 
 	// for test function
 	if fn != nil {
@@ -265,20 +447,145 @@ func (loader *bootloader) run(fn func() error) (err error) {
 }
 
 func (loader *bootloader) Wait() (err error) {
-	loader.errg.Wait()
-	// destroy
+	errc := make(chan error, 1)
+	go func() {
+		errc <- loader.errg.Wait()
+	}()
+	stopped := false
+	select {
+	case err = <-errc:
+		stopped = true
+	case <-loader.ctx.Done():
+	}
+	// the shutdown has begun
+	ctx, cancel := loader.shutdownContext()
+	defer cancel()
+	serr := loader.destroy(ctx)
+	if !stopped {
+		select {
+		case err = <-errc:
+		case <-ctx.Done():
+		}
+	}
+	if serr == nil {
+		return err
+	}
+	serr.Cause = err
+	return serr
+}
+
+func (loader *bootloader) shutdownContext() (context.Context, context.CancelFunc) {
+	if d := time.Duration(atomic.LoadInt64(&loader.shutdownTimeout)); d > 0 {
+		return context.WithTimeout(context.Background(), d)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// pending returns the paths of the modules in status.
+func (loader *bootloader) pending(status int32) []string {
+	var paths []string
 	for _, m := range loader.g.List() {
-		destroyer, _ := m.rv.Interface().(OnDestroyer)
-		if destroyer != nil {
-			loader.errg.Go(func() error {
-				destroyer.OnDestroy()
-				return nil
-			})
+		if m.Status() == status {
+			paths = append(paths, m.Path())
 		}
 	}
-	return nil
+	return paths
+}
+
+// destroy stops the started modules, and those whose start hook failed,
+// in reverse dependency order, so that dependents are destroyed before
+// their dependencies. Modules whose start hook is still running, and
+// their dependencies, are destroyed last, once the hook returns. It
+// gives up once ctx is done. The errors of the stop hooks are reported
+// along with those of the destroy hooks.
+func (loader *bootloader) destroy(ctx context.Context) *ShutdownError {
+	var (
+		errs  []error
+		mutex sync.Mutex
+	)
+	record := func(err error) {
+		if err != nil {
+			loader.log.Println(err)
+			mutex.Lock()
+			errs = append(errs, err)
+			mutex.Unlock()
+		}
+	}
+	destroy := func(m *wrappedModule) {
+		record(m.StopErr())
+		if m.Destroyable() {
+			record(m.Destroy(ctx))
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ls := loader.g.DependencyOrder()
+		blocked := make(map[*wrappedModule]bool)
+		var block func(m *wrappedModule)
+		block = func(m *wrappedModule) {
+			if !blocked[m] {
+				blocked[m] = true
+				for _, dep := range m.Dependencies() {
+					block(dep)
+				}
+			}
+		}
+		for _, m := range ls {
+			if m.Running() {
+				block(m)
+			}
+		}
+		var later []*wrappedModule
+		for i := len(ls) - 1; i >= 0 && ctx.Err() == nil; i-- {
+			if blocked[ls[i]] {
+				later = append(later, ls[i])
+			} else {
+				destroy(ls[i])
+			}
+		}
+		for _, m := range later {
+			if atomic.LoadInt32(&m.supervised) != 0 {
+				select {
+				case <-m.superviseDone:
+				case <-ctx.Done():
+					return
+				}
+			}
+			destroy(m)
+		}
+	}()
+	var serr *ShutdownError
+	select {
+	case <-done:
+	case <-ctx.Done():
+		serr = &ShutdownError{Pending: loader.pending(statusDestroying), Starting: loader.running()}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(errs) > 0 {
+		if serr == nil {
+			serr = &ShutdownError{}
+		}
+		serr.Errors = append([]error(nil), errs...)
+	}
+	return serr
+}
+
+// running returns the paths of the modules whose start hook is
+// still running.
+func (loader *bootloader) running() []string {
+	var paths []string
+	for _, m := range loader.g.List() {
+		if m.Running() {
+			paths = append(paths, m.Path())
+		}
+	}
+	return paths
 }
 
+// Shutdown cancels the context handed to the modules and stops the
+// running ones; Wait returns once all of them have been destroyed.
 func (loader *bootloader) Shutdown() error {
 	if loader.cancel != nil {
 		loader.cancel()
@@ -0,0 +1,409 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type lifecycleModule struct {
+	startErr  error
+	destroyed bool
+}
+
+func (m *lifecycleModule) OnStart(ctx context.Context) error {
+	return m.startErr
+}
+
+func (m *lifecycleModule) OnDestroy(ctx context.Context) error {
+	m.destroyed = true
+	return nil
+}
+
+type failingCreateModule struct{}
+
+func (m *failingCreateModule) OnCreate(ctx context.Context) error {
+	return errors.New("open database")
+}
+
+func Test_Bootloader_StartError(t *testing.T) {
+	loader := newBootloader()
+	errStart := errors.New("listen failed")
+	ok := &lifecycleModule{}
+	bad := &lifecycleModule{startErr: errStart}
+	if err := loader.Add("ok", ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Add("bad", bad); err != nil {
+		t.Fatal(err)
+	}
+	err := loader.Launch()
+	var merr *ModuleError
+	if !errors.As(err, &merr) || merr.Phase != PhaseStart || merr.Err != errStart {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !ok.destroyed {
+		t.Errorf("started module was not destroyed")
+	}
+	if !bad.destroyed {
+		t.Errorf("module failed in start was not destroyed")
+	}
+}
+
+func Test_Bootloader_CreateError(t *testing.T) {
+	loader := newBootloader()
+	if err := loader.Add("db", &failingCreateModule{}); err == nil {
+		t.Fatal("expected create error")
+	}
+	if _, err := loader.Get("db"); err == nil {
+		t.Errorf("failed module was registered")
+	}
+	if err := loader.Launch(); err == nil {
+		t.Errorf("expected Launch to report create error")
+	}
+}
+
+type destroyRecorder struct {
+	order *[]string
+	name  string
+	err   error
+}
+
+func (r *destroyRecorder) OnDestroy(ctx context.Context) error {
+	*r.order = append(*r.order, r.name)
+	return r.err
+}
+
+type repoModule struct {
+	destroyRecorder
+}
+
+type serviceModule struct {
+	destroyRecorder
+	Repo *repoModule `bloader:"repo"`
+}
+
+func Test_Bootloader_DestroyOrder(t *testing.T) {
+	loader := newBootloader()
+	var order []string
+	errStop := errors.New("flush failed")
+	svc := &serviceModule{destroyRecorder: destroyRecorder{order: &order, name: "service", err: errStop}}
+	repo := &repoModule{destroyRecorder{order: &order, name: "repo"}}
+	if err := loader.AddByAuto(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Add("repo", repo); err != nil {
+		t.Fatal(err)
+	}
+	err := loader.Launch()
+	if len(order) != 2 || order[0] != "service" || order[1] != "repo" {
+		t.Fatalf("unexpected destroy order %v", order)
+	}
+	var serr *ShutdownError
+	if !errors.As(err, &serr) || len(serr.Errors) != 1 || !errors.Is(serr.Errors[0], errStop) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+type blockingModule struct {
+	quit chan struct{}
+}
+
+func (m *blockingModule) OnStart() {
+	<-m.quit
+}
+
+func (m *blockingModule) OnStop(ctx context.Context) error {
+	close(m.quit)
+	return nil
+}
+
+type contextModule struct{}
+
+func (m *contextModule) OnStart(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func Test_Bootloader_Shutdown(t *testing.T) {
+	loader := newBootloader()
+	if err := loader.AddByAuto(&blockingModule{quit: make(chan struct{})}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.AddByAuto(&contextModule{}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- loader.Launch()
+	}()
+	loader.Shutdown()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after Shutdown")
+	}
+}
+
+type hangingModule struct {
+	hook Phase
+}
+
+func (m *hangingModule) OnCreate(ctx context.Context) error {
+	if m.hook == PhaseCreate {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func (m *hangingModule) OnDestroy(ctx context.Context) error {
+	if m.hook == PhaseDestroy {
+		select {}
+	}
+	return nil
+}
+
+func Test_Bootloader_Timeout(t *testing.T) {
+	loader := newBootloader()
+	loader.SetTimeout(PhaseCreate, time.Hour)
+	err := loader.AddByAuto(&hangingModule{hook: PhaseCreate}, Timeout(PhaseCreate, 10*time.Millisecond))
+	var merr *ModuleError
+	if !errors.As(err, &merr) || merr.Phase != PhaseCreate || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !strings.Contains(err.Error(), "hangingModule") {
+		t.Errorf("error does not name the module: %v", err)
+	}
+}
+
+func Test_Bootloader_ShutdownTimeout(t *testing.T) {
+	loader := newBootloader()
+	loader.SetShutdownTimeout(10 * time.Millisecond)
+	if err := loader.AddByAuto(&hangingModule{hook: PhaseDestroy}); err != nil {
+		t.Fatal(err)
+	}
+	err := loader.Launch()
+	var serr *ShutdownError
+	if !errors.As(err, &serr) || len(serr.Pending) != 1 || !strings.HasSuffix(serr.Pending[0], "hangingModule") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+type stubbornModule struct {
+	quit chan struct{}
+}
+
+func (m *stubbornModule) OnStart(ctx context.Context) error {
+	<-m.quit
+	return nil
+}
+
+func Test_Bootloader_ShutdownTimeout_Starting(t *testing.T) {
+	loader := newBootloader()
+	loader.SetShutdownTimeout(20 * time.Millisecond)
+	stubborn := &stubbornModule{quit: make(chan struct{})}
+	defer close(stubborn.quit)
+	lifecycle := &lifecycleModule{}
+	if err := loader.Add("stubborn", stubborn); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Add("lifecycle", lifecycle); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for loader.(*bootloader).g.FindByName("lifecycle").Status() != statusStarted {
+		time.Sleep(time.Millisecond)
+	}
+	loader.Shutdown()
+	err := loader.Wait()
+	var serr *ShutdownError
+	if !errors.As(err, &serr) || len(serr.Starting) != 1 || !strings.HasSuffix(serr.Starting[0], "stubbornModule") || len(serr.Pending) != 0 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !lifecycle.destroyed {
+		t.Errorf("started module not destroyed")
+	}
+}
+
+type panickingModule struct{}
+
+func (m *panickingModule) OnStart() {
+	panic("boom")
+}
+
+func Test_Bootloader_Panic(t *testing.T) {
+	loader := newBootloader()
+	ok := &lifecycleModule{}
+	if err := loader.AddByAuto(ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.AddByAuto(&panickingModule{}); err != nil {
+		t.Fatal(err)
+	}
+	err := loader.Launch()
+	var merr *ModuleError
+	var perr *PanicError
+	if !errors.As(err, &merr) || merr.Phase != PhaseStart || !errors.As(err, &perr) || perr.Value != "boom" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(perr.Stack) == 0 {
+		t.Errorf("missing stack trace")
+	}
+	if strings.Contains(err.Error(), "\n") {
+		t.Errorf("stack trace in error message: %v", err)
+	}
+	if !ok.destroyed {
+		t.Errorf("started module was not destroyed")
+	}
+}
+
+type flakyModule struct {
+	failures int
+	runs     int
+}
+
+func (m *flakyModule) OnStart(ctx context.Context) error {
+	m.runs++
+	if m.runs <= m.failures {
+		return errors.New("transient")
+	}
+	return nil
+}
+
+func Test_Bootloader_Restart(t *testing.T) {
+	loader := newBootloader()
+	policy := RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3, Backoff: time.Millisecond}
+	m := &flakyModule{failures: 2}
+	if err := loader.AddByAuto(m, Restart(policy)); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Launch(); err != nil {
+		t.Fatal(err)
+	}
+	if m.runs != 3 {
+		t.Errorf("runs %d expected 3", m.runs)
+	}
+}
+
+func Test_Bootloader_RestartExhausted(t *testing.T) {
+	loader := newBootloader()
+	policy := RestartPolicy{Mode: RestartOnFailure, MaxRetries: 2, Backoff: time.Millisecond}
+	m := &flakyModule{failures: 10}
+	if err := loader.AddByAuto(m, Restart(policy)); err != nil {
+		t.Fatal(err)
+	}
+	err := loader.Launch()
+	if err == nil || !strings.Contains(err.Error(), "restart budget of 2 exhausted") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if m.runs != 3 {
+		t.Errorf("runs %d expected 3", m.runs)
+	}
+}
+
+func Test_Bootloader_RestartDefaultBackoff(t *testing.T) {
+	loader := newBootloader()
+	if err := loader.Add("worker", &lifecycleModule{}, Restart(RestartPolicy{Mode: RestartAlways})); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	loader.Shutdown()
+	loader.Wait()
+	if restarts := loader.Modules()[0].Restarts; restarts > 1 {
+		t.Errorf("%d restarts without backoff", restarts)
+	}
+}
+
+type wrappedCancelModule struct{}
+
+func (m *wrappedCancelModule) OnStart(ctx context.Context) error {
+	<-ctx.Done()
+	return fmt.Errorf("serve: %w", ctx.Err())
+}
+
+type failingStopModule struct {
+	blockingModule
+	err error
+}
+
+func (m *failingStopModule) OnStop(ctx context.Context) error {
+	m.blockingModule.OnStop(ctx)
+	return m.err
+}
+
+func Test_Bootloader_ShutdownErrors(t *testing.T) {
+	loader := newBootloader()
+	if err := loader.Add("quiet", &wrappedCancelModule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	loader.Shutdown()
+	if err := loader.Wait(); err != nil {
+		t.Fatalf("wrapped cancellation reported as a failure: %v", err)
+	}
+
+	loader = newBootloader()
+	errStop := errors.New("close failed")
+	if err := loader.Add("noisy", &failingStopModule{blockingModule{quit: make(chan struct{})}, errStop}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	loader.Shutdown()
+	err := loader.Wait()
+	var serr *ShutdownError
+	if !errors.As(err, &serr) || len(serr.Errors) != 1 || !errors.Is(serr.Errors[0], errStop) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+type drainingModule struct {
+	drained chan struct{}
+}
+
+func (m *drainingModule) OnStart(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (m *drainingModule) OnStop(ctx context.Context) error {
+	<-ctx.Done()
+	close(m.drained)
+	return nil
+}
+
+func Test_Bootloader_StopDeadline(t *testing.T) {
+	loader := newBootloader()
+	loader.SetShutdownTimeout(20 * time.Millisecond)
+	draining := &drainingModule{drained: make(chan struct{})}
+	if err := loader.AddByAuto(draining); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for loader.(*bootloader).g.List()[0].Status() != statusStarting {
+		time.Sleep(time.Millisecond)
+	}
+	loader.Shutdown()
+	loader.Wait()
+	select {
+	case <-draining.drained:
+	case <-time.After(time.Second):
+		t.Errorf("stop hook not bounded by the shutdown timeout")
+	}
+}
@@ -0,0 +1,205 @@
+package bootloader
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// convert converts a property value to t. Strings are parsed into
+// numbers, bools, durations, comma-separated slices and types
+// implementing encoding.TextUnmarshaler; numbers are converted between
+// numeric types as long as they fit.
+func convert(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Interface && v.IsNil()) {
+		return zero, fmt.Errorf("cannot convert nil to %s", t)
+	}
+	if v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		return convert(v.Elem(), t)
+	}
+	if t.Kind() == reflect.Ptr {
+		e, err := convert(v, t.Elem())
+		if err != nil {
+			return zero, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(e)
+		return p, nil
+	}
+	if v.Kind() == reflect.String {
+		return convertString(v.String(), t)
+	}
+	if isNumber(v.Kind()) && isNumber(t.Kind()) {
+		return convertNumber(v, t)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		switch {
+		case isNumber(v.Kind()), v.Kind() == reflect.Bool:
+			return reflect.ValueOf(fmt.Sprint(v.Interface())).Convert(t), nil
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			return convertSlice(v, t)
+		}
+	}
+	return zero, fmt.Errorf("cannot convert %s to %s", v.Type(), t)
+}
+
+func convertString(s string, t reflect.Type) (reflect.Value, error) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		p := reflect.New(t)
+		if err := p.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return zero, err
+		}
+		return p.Elem(), nil
+	}
+	if t == durationType {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return zero, err
+		}
+		return reflect.ValueOf(d), nil
+	}
+	s = strings.TrimSpace(s)
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return zero, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return zero, err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return zero, err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return zero, err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf([]byte(s)).Convert(t), nil
+		}
+		var items []string
+		if s != "" {
+			items = strings.Split(s, ",")
+		}
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		return convertSlice(reflect.ValueOf(items), t)
+	default:
+		return zero, fmt.Errorf("cannot convert string %q to %s", s, t)
+	}
+	return v, nil
+}
+
+func convertNumber(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return zero, fmt.Errorf("cannot convert %v to %s", f, t)
+			}
+			i = int64(f)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if v.Uint() > math.MaxInt64 {
+				return zero, fmt.Errorf("%v overflows %s", v.Uint(), t)
+			}
+			i = int64(v.Uint())
+		default:
+			i = v.Int()
+		}
+		if out.OverflowInt(i) {
+			return zero, fmt.Errorf("%v overflows %s", i, t)
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+				return zero, fmt.Errorf("cannot convert %v to %s", f, t)
+			}
+			u = uint64(f)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() < 0 {
+				return zero, fmt.Errorf("cannot convert %v to %s", v.Int(), t)
+			}
+			u = uint64(v.Int())
+		default:
+			u = v.Uint()
+		}
+		if out.OverflowUint(u) {
+			return zero, fmt.Errorf("%v overflows %s", u, t)
+		}
+		out.SetUint(u)
+	default:
+		out.Set(v.Convert(t))
+	}
+	return out, nil
+}
+
+func convertSlice(v reflect.Value, t reflect.Type) (reflect.Value, error) {
+	var out reflect.Value
+	if t.Kind() == reflect.Array {
+		if v.Len() > t.Len() {
+			return zero, fmt.Errorf("%d values overflow %s", v.Len(), t)
+		}
+		out = reflect.New(t).Elem()
+	} else {
+		out = reflect.MakeSlice(t, v.Len(), v.Len())
+	}
+	for i := 0; i < v.Len(); i++ {
+		e, err := convert(v.Index(i), t.Elem())
+		if err != nil {
+			return zero, fmt.Errorf("index %d: %v", i, err)
+		}
+		out.Index(i).Set(e)
+	}
+	return out, nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package bootloader
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_Convert(t *testing.T) {
+	cases := []struct {
+		in  interface{}
+		out interface{}
+	}{
+		{"8080", int(8080)},
+		{"0x10", int64(16)},
+		{" 1.5 ", float64(1.5)},
+		{"true", true},
+		{"5s", 5 * time.Second},
+		{"a, b,c", []string{"a", "b", "c"}},
+		{"1,2", []int{1, 2}},
+		{"127.0.0.1", net.ParseIP("127.0.0.1")},
+		{float64(3), int(3)},
+		{int(3), float64(3)},
+		{int64(7), uint8(7)},
+		{int(42), "42"},
+		{[]interface{}{"1", 2.0}, []int{1, 2}},
+		{"9", func() *int { i := 9; return &i }()},
+	}
+	for _, c := range cases {
+		v, err := convert(reflect.ValueOf(c.in), reflect.TypeOf(c.out))
+		if err != nil {
+			t.Errorf("%#v: %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Interface(), c.out) {
+			t.Errorf("%#v: got %#v expected %#v", c.in, v.Interface(), c.out)
+		}
+	}
+
+	failures := []struct {
+		in interface{}
+		tp reflect.Type
+	}{
+		{"abc", reflect.TypeOf(0)},
+		{float64(1.5), reflect.TypeOf(0)},
+		{int(300), reflect.TypeOf(uint8(0))},
+		{int(-1), reflect.TypeOf(uint(0))},
+		{true, reflect.TypeOf(0)},
+	}
+	for _, c := range failures {
+		if _, err := convert(reflect.ValueOf(c.in), c.tp); err == nil {
+			t.Errorf("%#v to %s: expected error", c.in, c.tp)
+		}
+	}
+}
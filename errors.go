@@ -0,0 +1,99 @@
+package bootloader
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrTimeout is wrapped by the errors of lifecycle hooks that exceeded
+// their timeout.
+var ErrTimeout = errors.New("timed out")
+
+// ErrNotRunning is reported by the health check of a module that
+// is not running.
+var ErrNotRunning = errors.New("not running")
+
+// ModuleError reports a failure of a module lifecycle hook.
+type ModuleError struct {
+	Path  string
+	Phase Phase
+	Err   error
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("bootloader: Module %s, %s failed: %v", e.Path, e.Phase, e.Err)
+}
+
+func (e *ModuleError) Unwrap() error {
+	return e.Err
+}
+
+// ShutdownError reports the modules that failed to stop.
+// Cause is the error that triggered the shutdown, if any. Pending
+// lists the modules that were still being destroyed and Starting the
+// modules whose start hook was still running when the shutdown
+// deadline expired.
+type ShutdownError struct {
+	Cause    error
+	Errors   []error
+	Pending  []string
+	Starting []string
+}
+
+func (e *ShutdownError) Error() string {
+	var b strings.Builder
+	b.WriteString("bootloader: shutdown failed")
+	if e.Cause != nil {
+		fmt.Fprintf(&b, " after %v", e.Cause)
+	}
+	for _, err := range e.Errors {
+		b.WriteString("; ")
+		b.WriteString(err.Error())
+	}
+	if len(e.Pending) > 0 {
+		b.WriteString("; deadline exceeded, still destroying: ")
+		b.WriteString(strings.Join(e.Pending, ", "))
+	}
+	if len(e.Starting) > 0 {
+		b.WriteString("; deadline exceeded, still starting: ")
+		b.WriteString(strings.Join(e.Starting, ", "))
+	}
+	return b.String()
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Cause
+}
+
+// PanicError is the error of a lifecycle hook that panicked. Stack
+// holds the stack trace of the panic, which Error leaves out.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// AmbiguityError reports several modules matching an injected type
+// with none of them marked as primary.
+type AmbiguityError struct {
+	Type       reflect.Type
+	Candidates []string
+}
+
+func newAmbiguityError(tp reflect.Type, candidates []*wrappedModule) *AmbiguityError {
+	e := &AmbiguityError{Type: tp}
+	for _, m := range candidates {
+		e.Candidates = append(e.Candidates, m.Key())
+	}
+	return e
+}
+
+func (e *AmbiguityError) Error() string {
+	return fmt.Sprintf("bootloader: %d modules match %s: %s; mark one as Primary",
+		len(e.Candidates), e.Type, strings.Join(e.Candidates, ", "))
+}
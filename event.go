@@ -0,0 +1,78 @@
+package bootloader
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event describes a status transition of a module. Duration is the time
+// spent in the lifecycle hook and Err its error, if the module failed.
+type Event struct {
+	Name     string
+	Path     string
+	Phase    Phase
+	From     Status
+	To       Status
+	Time     time.Time
+	Duration time.Duration
+	Err      error
+}
+
+func newSubscribers(log Logger) *subscribers {
+	return &subscribers{fns: make(map[int]func(Event)), log: log}
+}
+
+type subscribers struct {
+	fns   map[int]func(Event)
+	next  int
+	log   Logger
+	mutex sync.RWMutex
+}
+
+func (s *subscribers) Subscribe(fn func(Event)) (unsubscribe func()) {
+	s.mutex.Lock()
+	id := s.next
+	s.next++
+	s.fns[id] = fn
+	s.mutex.Unlock()
+	return func() {
+		s.mutex.Lock()
+		delete(s.fns, id)
+		s.mutex.Unlock()
+	}
+}
+
+// Publish delivers e to the subscribers in subscription order. The
+// subscribers may subscribe or unsubscribe from the callback, and a
+// panicking subscriber is logged without stopping the delivery.
+func (s *subscribers) Publish(e Event) {
+	s.mutex.RLock()
+	ids := make([]int, 0, len(s.fns))
+	for id := range s.fns {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	fns := make([]func(Event), len(ids))
+	for i, id := range ids {
+		fns[i] = s.fns[id]
+	}
+	s.mutex.RUnlock()
+	for _, fn := range fns {
+		err := safeCall(context.Background(), func(context.Context) error {
+			fn(e)
+			return nil
+		})
+		if err != nil {
+			s.log.Println("bootloader: subscriber", err)
+		}
+	}
+}
+
+// Subscribe registers fn to receive the lifecycle events of every module.
+// Events are delivered synchronously from the goroutine running the
+// transition, so fn must not block. The returned function unsubscribes fn.
+func (loader *bootloader) Subscribe(fn func(Event)) (unsubscribe func()) {
+	return loader.subs.Subscribe(fn)
+}
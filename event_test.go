@@ -0,0 +1,71 @@
+package bootloader
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Bootloader_Subscribe(t *testing.T) {
+	loader := newBootloader()
+	var (
+		mutex  sync.Mutex
+		events []Event
+	)
+	unsubscribe := loader.Subscribe(func(e Event) {
+		mutex.Lock()
+		events = append(events, e)
+		mutex.Unlock()
+	})
+	errStart := errors.New("listen failed")
+	if err := loader.Add("bad", &lifecycleModule{startErr: errStart}); err != nil {
+		t.Fatal(err)
+	}
+	loader.Launch()
+	unsubscribe()
+
+	expected := []Status{StatusCreating, StatusCreated, StatusMounting, StatusMounted, StatusStarting, StatusFailed,
+		StatusDestroying, StatusDestroyed}
+	if len(events) != len(expected) {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	for i, e := range events {
+		if e.To != expected[i] || e.Name != "bad" {
+			t.Errorf("event %d: %+v expected status %s", i, e, expected[i])
+		}
+	}
+	failed := events[5]
+	if failed.Phase != PhaseStart || failed.From != StatusStarting || !errors.Is(failed.Err, errStart) {
+		t.Errorf("unexpected failed event %+v", failed)
+	}
+}
+
+func Test_Bootloader_Subscribe_Reentrant(t *testing.T) {
+	loader := newBootloader()
+	var unsubscribe func()
+	calls := 0
+	unsubscribe = loader.Subscribe(func(e Event) {
+		calls++
+		unsubscribe()
+		loader.Subscribe(func(Event) {})
+	})
+	loader.Subscribe(func(Event) {
+		panic("bad subscriber")
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- loader.Add("ok", &lifecycleModule{})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Add deadlocked in a subscriber")
+	}
+	if calls != 1 {
+		t.Errorf("unsubscribed subscriber called %d times", calls)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -45,6 +46,7 @@ func (s *UserService) GetUser() *User {
 type Server struct {
 	UserService *UserService `bloader:"user-service"`
 	RuntimeInfo *RuntimeInfo `bloader:"auto"`
+	srv         *http.Server
 }
 
 func (s *Server) home(w http.ResponseWriter, r *http.Request) {
@@ -52,10 +54,22 @@ func (s *Server) home(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(s.RuntimeInfo)
 }
 
-func (s *Server) OnStart() {
-	http.HandleFunc("/", s.home)
+func (s *Server) OnCreate() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.home)
+	s.srv = &http.Server{Addr: ":8888", Handler: mux}
+}
+
+func (s *Server) OnStart(ctx context.Context) error {
 	log.Println("server started.")
-	http.ListenAndServe(":8888", nil)
+	if err := s.srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) OnStop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
 }
 
 func main() {
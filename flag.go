@@ -0,0 +1,166 @@
+package bootloader
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const flagSetName = "set"
+
+// setFlag collects repeated --set key=value overrides.
+type setFlag struct {
+	p *properties
+}
+
+func (f *setFlag) String() string {
+	return ""
+}
+
+func (f *setFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	f.p.setFlag(strings.TrimSpace(s[:i]), reflect.ValueOf(s[i+1:]))
+	return nil
+}
+
+// propertyFlag overrides a single property, converting the argument
+// to the type of the current value.
+type propertyFlag struct {
+	p   *properties
+	key string
+	def reflect.Value
+}
+
+func (f *propertyFlag) String() string {
+	if f == nil || !f.def.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(f.def.Interface())
+}
+
+func (f *propertyFlag) Set(s string) error {
+	v, err := convert(reflect.ValueOf(s), f.def.Type())
+	if err != nil {
+		return err
+	}
+	f.p.setFlag(f.key, v)
+	return nil
+}
+
+func (f *propertyFlag) IsBoolFlag() bool {
+	return f.def.Kind() == reflect.Bool
+}
+
+func (p *properties) setFlag(key string, v reflect.Value) {
+	p.mutex.Lock()
+	p.source(SourceFlags, PriorityFlags, MergeDeep).data[p.prefix+strings.ToLower(key)] = v
+	p.mutex.Unlock()
+}
+
+// leaves returns the scalar properties of the static sources, each
+// with the value of the highest source defining it. Dynamic sources,
+// such as the environment, are left out, and so are the keys hidden by
+// a source replacing their subtree and the lengths of slices.
+func (p *properties) leaves() map[string]reflect.Value {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	leaves := make(map[string]reflect.Value)
+	for _, s := range p.sources {
+		if s.lookup != nil {
+			continue
+		}
+		for key := range s.data {
+			key = key[len(p.prefix):]
+			if _, ok := leaves[key]; ok || p.isLength(s, key) {
+				continue
+			}
+			v := p.static(key)
+			for v.Kind() == reflect.Interface && !v.IsNil() {
+				v = v.Elem()
+			}
+			switch v.Kind() {
+			case reflect.Bool, reflect.String,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				if v.CanInterface() {
+					leaves[key] = v
+				}
+			}
+		}
+	}
+	return leaves
+}
+
+// static returns the value of key in the highest static source, unless
+// a source replacing a parent of key hides it, like find.
+func (p *properties) static(key string) reflect.Value {
+	for i := len(p.sources) - 1; i >= 0; i-- {
+		s := p.sources[i]
+		if s.lookup == nil {
+			if v, ok := s.data[p.prefix+key]; ok {
+				return v
+			}
+		}
+		if s.merge == MergeReplace && p.shadows(s, key) {
+			break
+		}
+	}
+	return zero
+}
+
+// isLength reports whether key is the length of a slice of s.
+func (p *properties) isLength(s *propertySource, key string) bool {
+	i := strings.LastIndexByte(key, '.')
+	if i < 0 || key[i+1:] != propertyLengthKey {
+		return false
+	}
+	v := s.data[p.prefix+key[:i]]
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
+
+// RegisterFlags defines a typed flag on fs, such as --db.port, for every
+// scalar property known so far. Flags already defined on fs are kept.
+func (loader *bootloader) RegisterFlags(fs *flag.FlagSet) {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	leaves := loader.props.leaves()
+	keys := make([]string, 0, len(leaves))
+	for key := range leaves {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if fs.Lookup(key) != nil {
+			continue
+		}
+		fs.Var(&propertyFlag{p: loader.props, key: key, def: leaves[key]}, key, "property "+key)
+	}
+}
+
+// ParseFlags parses args with fs, accepting repeated --set key=value
+// overrides of the properties. Flag overrides take precedence over every
+// other property source. A nil fs and args default to flag.CommandLine
+// and os.Args[1:].
+func (loader *bootloader) ParseFlags(fs *flag.FlagSet, args []string) error {
+	if fs == nil {
+		fs = flag.CommandLine
+	}
+	if args == nil {
+		args = os.Args[1:]
+	}
+	if fs.Lookup(flagSetName) == nil {
+		fs.Var(&setFlag{p: loader.props}, flagSetName, "override a property, as key=value")
+	}
+	return fs.Parse(args)
+}
@@ -0,0 +1,92 @@
+package bootloader
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_ParseFlags(t *testing.T) {
+	os.Setenv("BLFLAG_DB_PORT", "6543")
+	defer os.Unsetenv("BLFLAG_DB_PORT")
+
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"db":      map[string]interface{}{"port": 5432, "host": "localhost"},
+		"debug":   false,
+		"timeout": time.Second,
+	})
+	loader.EnableEnv("BLFLAG", "")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	loader.RegisterFlags(fs)
+	for _, name := range []string{"db.port", "db.host", "debug", "timeout"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("flag %s not registered", name)
+		}
+	}
+	err := loader.ParseFlags(fs, []string{"--set", "db.port=7000", "-debug", "--timeout=3s", "--set=db.user=admin", "rest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.NArg() != 1 || fs.Arg(0) != "rest" {
+		t.Errorf("unexpected args %v", fs.Args())
+	}
+
+	var cfg struct {
+		Port int
+		Host string
+		User string
+	}
+	if err := loader.BindProperties("db", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 7000 || cfg.Host != "localhost" || cfg.User != "admin" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if v, _ := loader.GetProperty("debug"); v != true {
+		t.Errorf("unexpected debug %v", v)
+	}
+	if v, _ := loader.GetProperty("timeout"); v != 3*time.Second {
+		t.Errorf("unexpected timeout %v", v)
+	}
+
+	if err := loader.ParseFlags(fs, []string{"--set", "novalue"}); err == nil {
+		t.Error("expected error for malformed --set")
+	}
+	if err := loader.ParseFlags(fs, []string{"--db.port", "abc"}); err == nil {
+		t.Error("expected error for unconvertible flag")
+	}
+}
+
+func Test_RegisterFlags_Leaves(t *testing.T) {
+	loader := newBootloader()
+	loader.AddPropertySource(SourceDefaults, PriorityDefaults, map[string]interface{}{
+		"log":     map[string]interface{}{"level": "info", "format": "text"},
+		"servers": []string{"a", "b"},
+		"rope":    map[string]interface{}{"length": 3},
+	}, MergeDeep)
+	loader.AddPropertySource("override", PriorityFiles, map[string]interface{}{
+		"log": map[string]interface{}{"level": "debug"},
+	}, MergeReplace)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	loader.RegisterFlags(fs)
+	for _, name := range []string{"log.level", "servers.0", "servers.1", "rope.length"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("flag %s not registered", name)
+		}
+	}
+	for _, name := range []string{"log.format", "servers.length"} {
+		if fs.Lookup(name) != nil {
+			t.Errorf("unexpected flag %s", name)
+		}
+	}
+	if f := fs.Lookup("log.level"); f != nil && f.DefValue != "debug" {
+		t.Errorf("unexpected default %s", f.DefValue)
+	}
+}
@@ -1,6 +1,13 @@
 package bootloader
 
-import "testing"
+import (
+	"context"
+	"flag"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
 
 var global = newBootloader()
 
@@ -12,16 +19,20 @@ func Get(name string) (interface{}, error) {
 	return global.Get(name)
 }
 
-func Add(name string, x interface{}) error {
-	return global.Add(name, x)
+func Add(name string, x interface{}, opts ...Option) error {
+	return global.Add(name, x, opts...)
 }
 
-func AddFromType(x interface{}) error {
-	return global.AddFromType(x)
+func AddFromType(x interface{}, opts ...Option) error {
+	return global.AddFromType(x, opts...)
 }
 
-func AddByAuto(x interface{}) error {
-	return global.AddByAuto(x)
+func AddByAuto(x interface{}, opts ...Option) error {
+	return global.AddByAuto(x, opts...)
+}
+
+func Provide(fn interface{}, opts ...Option) error {
+	return global.Provide(fn, opts...)
 }
 
 func SetIgnores(name ...string) error {
@@ -40,10 +51,62 @@ func MuestGetProperty(name string) interface{} {
 	return global.MuestGetProperty(name)
 }
 
+func LoadProperties(path string) error {
+	return global.LoadProperties(path)
+}
+
+func BindProperties(prefix string, out interface{}) error {
+	return global.BindProperties(prefix, out)
+}
+
+func AddPropertySource(name string, priority int, data interface{}, merge MergeStrategy) error {
+	return global.AddPropertySource(name, priority, data, merge)
+}
+
+func PropertySource(key string) (string, bool) {
+	return global.PropertySource(key)
+}
+
+func ReloadProperties() error {
+	return global.ReloadProperties()
+}
+
+func WatchProperties(interval time.Duration) {
+	global.WatchProperties(interval)
+}
+
+func PropertyLock() sync.Locker {
+	return global.PropertyLock()
+}
+
+func RegisterFlags(fs *flag.FlagSet) {
+	global.RegisterFlags(fs)
+}
+
+func ParseFlags(fs *flag.FlagSet, args []string) error {
+	return global.ParseFlags(fs, args)
+}
+
+func EnableEnv(prefix, separator string) {
+	global.EnableEnv(prefix, separator)
+}
+
+func SetExpandEnv(enabled bool) {
+	global.SetExpandEnv(enabled)
+}
+
 func Launch() error {
 	return global.Launch()
 }
 
+func LaunchWithSignals(sig ...os.Signal) error {
+	return global.LaunchWithSignals(sig...)
+}
+
+func Reload() error {
+	return global.Reload()
+}
+
 func TestUnit(fn func() error) error {
 	return global.TestUnit(fn)
 }
@@ -56,6 +119,26 @@ func Wait() error {
 	return global.Wait()
 }
 
+func SetTimeout(phase Phase, d time.Duration) {
+	global.SetTimeout(phase, d)
+}
+
+func SetShutdownTimeout(d time.Duration) {
+	global.SetShutdownTimeout(d)
+}
+
+func Health(ctx context.Context) HealthReport {
+	return global.Health(ctx)
+}
+
+func Subscribe(fn func(Event)) (unsubscribe func()) {
+	return global.Subscribe(fn)
+}
+
+func Modules() []ModuleInfo {
+	return global.Modules()
+}
+
 func ShowLog(b bool) {
 	global.ShowLog(b)
 }
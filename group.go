@@ -6,7 +6,7 @@ import (
 	"sync"
 )
 
-func newGroup(OnBeforeAdding,
+func newGroup(OnBeforeAdding func(*wrappedModule) error,
 	OnAfterAdded func(*wrappedModule)) *group {
 	return &group{
 		namedDict:      make(map[string]*wrappedModule),
@@ -22,7 +22,7 @@ type group struct {
 	dict           []*wrappedModule
 	ignores        map[string]struct{}
 	mutex          sync.RWMutex
-	OnBeforeAdding func(*wrappedModule)
+	OnBeforeAdding func(*wrappedModule) error
 	OnAfterAdded   func(*wrappedModule)
 	log            Logger
 }
@@ -36,15 +36,17 @@ func (g *group) SetIgnores(name ...string) error {
 	return nil
 }
 
-func (g *group) AddByName(name string, m *wrappedModule) bool {
+func (g *group) AddByName(name string, m *wrappedModule) (bool, error) {
 	g.mutex.RLock()
 	_, ignore := g.ignores[name]
 	g.mutex.RUnlock()
 	if ignore {
-		return false
+		return false, nil
 	}
 	if g.OnBeforeAdding != nil {
-		g.OnBeforeAdding(m)
+		if err := g.OnBeforeAdding(m); err != nil {
+			return false, err
+		}
 	}
 	g.mutex.Lock()
 	if _, ok := g.namedDict[name]; ok {
@@ -58,12 +60,14 @@ func (g *group) AddByName(name string, m *wrappedModule) bool {
 	if g.OnAfterAdded != nil {
 		g.OnAfterAdded(m)
 	}
-	return true
+	return true, nil
 }
 
-func (g *group) AddByType(m *wrappedModule) bool {
+func (g *group) AddByType(m *wrappedModule) (bool, error) {
 	if g.OnBeforeAdding != nil {
-		g.OnBeforeAdding(m)
+		if err := g.OnBeforeAdding(m); err != nil {
+			return false, err
+		}
 	}
 	g.mutex.Lock()
 	g.dict = append(g.dict, m)
@@ -72,7 +76,7 @@ func (g *group) AddByType(m *wrappedModule) bool {
 	if g.OnAfterAdded != nil {
 		g.OnAfterAdded(m)
 	}
-	return true
+	return true, nil
 }
 
 func (g *group) FindByName(name string) *wrappedModule {
@@ -85,24 +89,66 @@ func (g *group) findByName(name string) *wrappedModule {
 	return g.namedDict[name]
 }
 
-func (g *group) FindByType(tp reflect.Type) *wrappedModule {
+func (g *group) FindByType(tp reflect.Type, qualifier string) (*wrappedModule, error) {
 	g.mutex.RLock()
 	defer g.mutex.RUnlock()
-	return g.findByType(tp)
+	return g.findByType(tp, qualifier)
 }
 
-func (g *group) findByType(tp reflect.Type) *wrappedModule {
+// findByType returns the module of type tp or, failing that, the module
+// assignable to tp, restricted to the modules with the given qualifier
+// if it is not empty. Several candidates are ambiguous unless exactly
+// one of them is primary.
+func (g *group) findByType(tp reflect.Type, qualifier string) (*wrappedModule, error) {
+	var candidates []*wrappedModule
 	for _, m := range g.dict {
-		if m.rt == tp {
-			return m
+		if m.rt == tp && m.Qualified(qualifier) {
+			candidates = append(candidates, m)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, m := range g.dict {
+			if m.rt.AssignableTo(tp) && m.Qualified(qualifier) {
+				candidates = append(candidates, m)
+			}
 		}
 	}
+	return choose(tp, candidates)
+}
+
+// FindAll returns the modules assignable to tp in registration order.
+func (g *group) FindAll(tp reflect.Type, qualifier string) []*wrappedModule {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+	var ls []*wrappedModule
 	for _, m := range g.dict {
-		if m.rt.ConvertibleTo(tp) {
-			return m
+		if m.rt.AssignableTo(tp) && m.Qualified(qualifier) {
+			ls = append(ls, m)
 		}
 	}
-	return nil
+	return ls
+}
+
+func choose(tp reflect.Type, candidates []*wrappedModule) (*wrappedModule, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return candidates[0], nil
+	}
+	var primary *wrappedModule
+	for _, m := range candidates {
+		if m.opts.primary {
+			if primary != nil {
+				return nil, newAmbiguityError(tp, candidates)
+			}
+			primary = m
+		}
+	}
+	if primary == nil {
+		return nil, newAmbiguityError(tp, candidates)
+	}
+	return primary, nil
 }
 
 func (g *group) Verify() {
@@ -122,6 +168,29 @@ func (g *group) List() []*wrappedModule {
 	return copied[:n]
 }
 
+// DependencyOrder returns the modules sorted so that every module
+// comes after the modules injected into it.
+func (g *group) DependencyOrder() []*wrappedModule {
+	ls := g.List()
+	sorted := make([]*wrappedModule, 0, len(ls))
+	visited := make(map[*wrappedModule]bool, len(ls))
+	var visit func(m *wrappedModule)
+	visit = func(m *wrappedModule) {
+		if visited[m] {
+			return
+		}
+		visited[m] = true
+		for _, dep := range m.Dependencies() {
+			visit(dep)
+		}
+		sorted = append(sorted, m)
+	}
+	for _, m := range ls {
+		visit(m)
+	}
+	return sorted
+}
+
 func (g *group) ForEach(fn func(x interface{})) []*wrappedModule {
 	g.mutex.RLock()
 	var copied = make([]*wrappedModule, 0, len(g.dict))
@@ -0,0 +1,62 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+// HealthStatus is the result of the health check of a module.
+type HealthStatus struct {
+	Name     string
+	Path     string
+	Err      error
+	Duration time.Duration
+}
+
+// HealthReport holds the health of every module implementing
+// OnHealthChecker, keyed by module name or, for unnamed modules, Path.
+type HealthReport struct {
+	Healthy bool
+	Modules map[string]HealthStatus
+}
+
+// Health runs the health checks of the modules concurrently, each bounded
+// by the PhaseHealthCheck timeout.
+func (loader *bootloader) Health(ctx context.Context) HealthReport {
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+	)
+	report := HealthReport{Healthy: true, Modules: make(map[string]HealthStatus)}
+	for _, m := range loader.g.List() {
+		if _, ok := m.rv.Interface().(OnHealthChecker); !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(m *wrappedModule) {
+			defer wg.Done()
+			begin := time.Now()
+			err := m.HealthCheck(ctx)
+			status := HealthStatus{Name: m.name, Path: m.Path(), Err: err, Duration: time.Since(begin)}
+			key := m.Key()
+			mutex.Lock()
+			for i := 2; ; i++ {
+				if _, ok := report.Modules[key]; !ok {
+					break
+				}
+				key = fmt.Sprintf("%s#%d", status.Path, i)
+			}
+			report.Modules[key] = status
+			if err != nil {
+				report.Healthy = false
+			}
+			mutex.Unlock()
+		}(m)
+	}
+	wg.Wait()
+	return report
+}
@@ -0,0 +1,58 @@
+package bootloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type checkedModule struct {
+	err  error
+	hang bool
+}
+
+func (m *checkedModule) HealthCheck(ctx context.Context) error {
+	if m.hang {
+		<-ctx.Done()
+	}
+	return m.err
+}
+
+func waitStarted(t *testing.T, loader *bootloader) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, m := range loader.g.List() {
+		for m.Status() != statusStarted {
+			if time.Now().After(deadline) {
+				t.Fatalf("module %s not started", m.Path())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func Test_Bootloader_Health(t *testing.T) {
+	loader := newBootloader().(*bootloader)
+	errDown := errors.New("connection refused")
+	loader.Add("db", &checkedModule{})
+	loader.Add("cache", &checkedModule{err: errDown})
+	loader.Add("slow", &checkedModule{hang: true}, Timeout(PhaseHealthCheck, 10*time.Millisecond))
+	waitStarted(t, loader)
+
+	report := loader.Health(context.Background())
+	if report.Healthy {
+		t.Errorf("report should be unhealthy")
+	}
+	if len(report.Modules) != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if err := report.Modules["db"].Err; err != nil {
+		t.Errorf("db: %v", err)
+	}
+	if err := report.Modules["cache"].Err; !errors.Is(err, errDown) {
+		t.Errorf("cache: %v", err)
+	}
+	if err := report.Modules["slow"].Err; !errors.Is(err, ErrTimeout) {
+		t.Errorf("slow: %v", err)
+	}
+}
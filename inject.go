@@ -1,13 +1,16 @@
 package bootloader
 
-import "fmt"
+import (
+	"fmt"
+	"reflect"
+)
 
 func newInjectionHandler(g *group,
 	OnBeforeInjectFieldHook,
 	OnAfterInjectFieldHook func(m *wrappedModule, f *wrappedField),
 	OnInjectCompleted func(m *wrappedModule)) *injectionHandler {
 	return &injectionHandler{
-		g, OnBeforeInjectFieldHook, OnAfterInjectFieldHook, OnInjectCompleted,
+		g, OnBeforeInjectFieldHook, OnAfterInjectFieldHook, OnInjectCompleted, false,
 	}
 }
 
@@ -16,9 +19,14 @@ type injectionHandler struct {
 	OnBeforeInjectFieldHook func(m *wrappedModule, f *wrappedField)
 	OnAfterInjectFieldHook  func(m *wrappedModule, f *wrappedField)
 	OnInjectCompleted       func(m *wrappedModule)
+
+	// collect is set once every module has been added,
+	// from then on collection fields can be injected
+	collect bool
 }
 
 func (h *injectionHandler) InjectAll() {
+	h.collect = true
 	ls := h.g.List()
 	for i := len(ls) - 1; i >= 0; i-- {
 		m := ls[i]
@@ -27,20 +35,41 @@ func (h *injectionHandler) InjectAll() {
 }
 
 func (h *injectionHandler) Inject(m *wrappedModule) {
-	if !m.TryInject() {
+	if m.Injected() {
 		return
 	}
 
 	for i := len(m.Fields()) - 1; i >= 0; i-- {
 		f := m.Fields()[i]
-		h.injectField(m, f)
+		if !f.injected {
+			h.injectField(m, f)
+		}
 	}
 
+	// an optional field may still be resolved by a module added later,
+	// so the module waits for InjectAll
+	if !h.collect && m.waitsOptional() {
+		return
+	}
 	if !m.TryInject() {
 		h.OnInjectCompleted(m)
 	}
 }
 
+// Check reports the AmbiguityError of an auto field of m before m is
+// added, so that the module is not registered half way.
+func (h *injectionHandler) Check(m *wrappedModule) error {
+	for _, f := range m.Fields() {
+		if f.key != structTagAutoVal {
+			continue
+		}
+		if _, err := h.g.FindByType(f.rt, f.qualifier); err != nil {
+			return fmt.Errorf("bootloader: Module %s, FiledName:%s, %w", m.Path(), f.name, err)
+		}
+	}
+	return nil
+}
+
 func (h *injectionHandler) injectField(m *wrappedModule, f *wrappedField) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -53,22 +82,74 @@ func (h *injectionHandler) injectField(m *wrappedModule, f *wrappedField) {
 	if h.OnBeforeInjectFieldHook != nil {
 		h.OnBeforeInjectFieldHook(m, f)
 	}
-	if f.tag == structTagAutoVal {
-		m := h.g.FindByType(f.rt)
+	if f.key == structTagAutoVal {
+		m, err := h.g.FindByType(f.rt, f.qualifier)
+		if err != nil {
+			panic(err)
+		}
 		if m != nil {
-			f.SetValue(m.rv)
+			f.SetModule(m)
+		} else if h.collect {
+			h.injectCollection(f)
 		}
 	} else {
-		m := h.g.FindByName(f.tag)
+		m := h.g.FindByName(f.key)
 		if m != nil {
-			f.SetValue(m.rv)
+			f.SetModule(m)
 		}
 	}
 }
 
+// injectCollection injects every module assignable to the element type
+// into a slice field, or every named one into a map[string] field.
+func (h *injectionHandler) injectCollection(f *wrappedField) {
+	switch f.rt.Kind() {
+	case reflect.Slice:
+		ls := h.g.FindAll(f.rt.Elem(), f.qualifier)
+		rv := reflect.MakeSlice(f.rt, 0, len(ls))
+		for _, m := range ls {
+			rv = reflect.Append(rv, m.rv)
+		}
+		f.SetModules(rv, ls)
+	case reflect.Map:
+		if f.rt.Key().Kind() != reflect.String {
+			return
+		}
+		ls := h.g.FindAll(f.rt.Elem(), f.qualifier)
+		rv := reflect.MakeMap(f.rt)
+		deps := ls[:0]
+		for _, m := range ls {
+			if m.name != "" {
+				rv.SetMapIndex(reflect.ValueOf(m.name).Convert(f.rt.Key()), m.rv)
+				deps = append(deps, m)
+			}
+		}
+		f.SetModules(rv, deps)
+	}
+}
+
 func (h *injectionHandler) Verify() {
 	ls := h.g.List()
 	for i := len(ls) - 1; i >= 0; i-- {
 		ls[i].MustInject()
+		h.verifyAuto(ls[i])
+	}
+}
+
+// verifyAuto resolves the single-valued auto fields of m again against
+// every module added, panicking with an AmbiguityError if a module added
+// after the injection makes the resolution ambiguous.
+func (h *injectionHandler) verifyAuto(m *wrappedModule) {
+	for _, f := range m.Fields() {
+		if f.key != structTagAutoVal || len(f.deps) != 1 || !f.deps[0].rt.AssignableTo(f.rt) {
+			continue
+		}
+		found, err := h.g.FindByType(f.rt, f.qualifier)
+		if err == nil && found != f.deps[0] {
+			err = newAmbiguityError(f.rt, []*wrappedModule{f.deps[0], found})
+		}
+		if err != nil {
+			panic(fmt.Errorf("bootloader: Module %s, FiledName:%s, %w", m.Path(), f.name, err))
+		}
 	}
 }
@@ -0,0 +1,168 @@
+package bootloader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type greeter interface {
+	Greet() string
+}
+
+type englishGreeter struct{}
+
+func (g *englishGreeter) Greet() string { return "hello" }
+
+type frenchGreeter struct{}
+
+func (g *frenchGreeter) Greet() string { return "bonjour" }
+
+type greeterClient struct {
+	Greeter greeter `bloader:"auto"`
+}
+
+func Test_Inject_Interface(t *testing.T) {
+	loader := newBootloader()
+	loader.AddByAuto(&englishGreeter{})
+	client := &greeterClient{}
+	loader.AddByAuto(client)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Greeter == nil || client.Greeter.Greet() != "hello" {
+		t.Errorf("unexpected greeter %v", client.Greeter)
+	}
+}
+
+func Test_Inject_Primary(t *testing.T) {
+	loader := newBootloader()
+	loader.AddByAuto(&englishGreeter{})
+	loader.AddByAuto(&frenchGreeter{}, Primary())
+	client := &greeterClient{}
+	loader.AddByAuto(client)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Greeter == nil || client.Greeter.Greet() != "bonjour" {
+		t.Errorf("unexpected greeter %v", client.Greeter)
+	}
+}
+
+func Test_Inject_Ambiguous(t *testing.T) {
+	loader := newBootloader().(*bootloader)
+	loader.Add("english", &englishGreeter{})
+	loader.AddByAuto(&frenchGreeter{})
+	_, err := loader.g.FindByType(reflect.TypeOf((*greeter)(nil)).Elem(), "")
+	var aerr *AmbiguityError
+	if !errors.As(err, &aerr) || len(aerr.Candidates) != 2 || aerr.Candidates[0] != "english" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	err = loader.AddByAuto(&greeterClient{})
+	if !errors.As(err, &aerr) || !strings.Contains(err.Error(), "mark one as Primary") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(loader.g.List()) != 2 {
+		t.Errorf("ambiguous module registered")
+	}
+}
+
+func Test_Inject_AmbiguousAfterInjection(t *testing.T) {
+	loader := newBootloader()
+	loader.AddByAuto(&englishGreeter{})
+	loader.AddByAuto(&greeterClient{})
+	loader.AddByAuto(&frenchGreeter{})
+	defer func() {
+		err, _ := recover().(error)
+		var aerr *AmbiguityError
+		if !errors.As(err, &aerr) || len(aerr.Candidates) != 2 {
+			t.Errorf("unexpected panic %v", err)
+		}
+	}()
+	loader.Run()
+	t.Errorf("Run did not fail")
+}
+
+type qualifiedClient struct {
+	Primary *providedDB `bloader:"auto"`
+	Replica *providedDB `bloader:"auto,qualifier=replica"`
+}
+
+func Test_Inject_Qualifier(t *testing.T) {
+	loader := newBootloader()
+	loader.Add("db", &providedDB{dsn: "primary"}, Primary())
+	loader.AddByAuto(&providedDB{dsn: "replica"}, Qualifier("replica"))
+	client := &qualifiedClient{}
+	loader.AddByAuto(client)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Primary == nil || client.Primary.dsn != "primary" {
+		t.Errorf("unexpected primary %+v", client.Primary)
+	}
+	if client.Replica == nil || client.Replica.dsn != "replica" {
+		t.Errorf("unexpected replica %+v", client.Replica)
+	}
+}
+
+type greeterRegistry struct {
+	All   []greeter          `bloader:"auto"`
+	Named map[string]greeter `bloader:"auto"`
+}
+
+func Test_Inject_Collection(t *testing.T) {
+	loader := newBootloader()
+	registry := &greeterRegistry{}
+	loader.AddByAuto(registry)
+	loader.Add("english", &englishGreeter{})
+	loader.AddByAuto(&frenchGreeter{})
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.All) != 2 || registry.All[0].Greet() != "hello" || registry.All[1].Greet() != "bonjour" {
+		t.Errorf("unexpected slice %v", registry.All)
+	}
+	if len(registry.Named) != 1 || registry.Named["english"] == nil {
+		t.Errorf("unexpected map %v", registry.Named)
+	}
+}
+
+type optionalClient struct {
+	Cache   *englishGreeter `bloader:"cache,optional"`
+	Feature interface{}     `bloader:"$feature.flag,optional"`
+}
+
+func Test_Inject_Optional(t *testing.T) {
+	loader := newBootloader().(*bootloader)
+	client := &optionalClient{}
+	loader.AddByAuto(client)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, loader)
+	if client.Cache != nil || client.Feature != nil {
+		t.Errorf("unexpected client %+v", client)
+	}
+
+	loader = newBootloader().(*bootloader)
+	client = &optionalClient{}
+	loader.Add("cache", &englishGreeter{})
+	loader.AddByAuto(client)
+	if client.Cache == nil {
+		t.Errorf("optional field not injected")
+	}
+
+	// the optional dependency is added after the module
+	loader = newBootloader().(*bootloader)
+	client = &optionalClient{}
+	loader.AddByAuto(client)
+	loader.Add("cache", &englishGreeter{})
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, loader)
+	if client.Cache == nil {
+		t.Errorf("optional field added later not injected")
+	}
+}
@@ -0,0 +1,62 @@
+package bootloader
+
+import (
+	"fmt"
+	"time"
+)
+
+// ModuleInfo describes a module held by the container.
+type ModuleInfo struct {
+	Name         string
+	Path         string
+	Status       Status
+	Dependencies []Dependency
+	Unresolved   []string
+	Restarts     int
+	Transitions  map[Status]time.Time
+}
+
+// Dependency describes a tagged field of a module, or a parameter of its
+// provider function named param[i] and tagged with its parameter name.
+// Modules are the Paths of the injected modules, empty for properties
+// and unresolved fields.
+type Dependency struct {
+	Field   string
+	Tag     string
+	Modules []string
+}
+
+// Modules describes the modules held by the container in registration order.
+func (loader *bootloader) Modules() []ModuleInfo {
+	ls := loader.g.List()
+	infos := make([]ModuleInfo, 0, len(ls))
+	for _, m := range ls {
+		info := ModuleInfo{
+			Name:        m.name,
+			Path:        m.Path(),
+			Status:      Status(m.Status()),
+			Restarts:    m.Restarts(),
+			Transitions: m.Transitions(),
+		}
+		for i := len(m.fields) - 1; i >= 0; i-- {
+			f := m.fields[i]
+			dep := Dependency{Field: f.name, Tag: f.tag}
+			for _, m := range f.deps {
+				dep.Modules = append(dep.Modules, m.Path())
+			}
+			info.Dependencies = append(info.Dependencies, dep)
+			if !f.injected {
+				info.Unresolved = append(info.Unresolved, f.name)
+			}
+		}
+		for i, param := range m.params {
+			dep := Dependency{Field: fmt.Sprintf("param[%d]", i), Modules: []string{param.Path()}}
+			if i < len(m.opts.params) {
+				dep.Tag = m.opts.params[i]
+			}
+			info.Dependencies = append(info.Dependencies, dep)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
@@ -0,0 +1,39 @@
+package bootloader
+
+import "testing"
+
+func Test_Bootloader_Modules(t *testing.T) {
+	loader := newBootloader().(*bootloader)
+	if err := loader.Add("service", &serviceModule{}); err != nil {
+		t.Fatal(err)
+	}
+	infos := loader.Modules()
+	if len(infos) != 1 {
+		t.Fatalf("unexpected modules %+v", infos)
+	}
+	info := infos[0]
+	if info.Name != "service" || info.Status != StatusCreated || info.Status.String() != "created" {
+		t.Errorf("unexpected module %+v", info)
+	}
+	if len(info.Unresolved) != 1 || info.Unresolved[0] != "Repo" {
+		t.Errorf("unexpected unresolved fields %v", info.Unresolved)
+	}
+	if _, ok := info.Transitions[StatusCreated]; !ok {
+		t.Errorf("missing created timestamp")
+	}
+
+	if err := loader.Add("repo", &repoModule{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	waitStarted(t, loader)
+	info = loader.Modules()[0]
+	if len(info.Unresolved) != 0 || len(info.Dependencies) != 1 || info.Dependencies[0].Modules[0] != loader.Modules()[1].Path {
+		t.Errorf("unexpected module %+v", info)
+	}
+	if info.Status != StatusStarted {
+		t.Errorf("status %s expected %s", info.Status, StatusStarted)
+	}
+}
@@ -0,0 +1,501 @@
+package bootloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// propertyParsers maps file extensions to the parsers of LoadProperties.
+var propertyParsers = map[string]func(data []byte) (map[string]interface{}, error){
+	".json":       parseJSON,
+	".ini":        parseINI,
+	".properties": parseINI,
+	".env":        parseEnv,
+	".toml":       parseTOML,
+	".yaml":       parseYAML,
+	".yml":        parseYAML,
+}
+
+// LoadProperties reads the properties of a JSON, INI, .properties, .env,
+// TOML or YAML file, detected by its extension. Only a subset of TOML
+// and YAML is supported: tables, scalars, arrays of scalars and, for
+// YAML, nested mappings and sequences. The variables of a .env file
+// map to keys like those of EnableEnv without a prefix, so that
+// DB_MAX_CONNS is db.max_conns. The file becomes the property
+// source "file:" followed by path, at PriorityFiles; loading it again
+// replaces its properties.
+func (loader *bootloader) LoadProperties(path string) error {
+	data, err := readProperties(path)
+	if err != nil {
+		return err
+	}
+	loader.props.add(fileSourcePrefix+path, PriorityFiles, MergeDeep, data)
+	loader.log.Println("bootloader: load properties", path)
+	return nil
+}
+
+// envVariables holds the variables of a .env file, which map to keys
+// the way the environment overlay does: DB_MAX_CONNS is db.max_conns.
+type envVariables map[string]interface{}
+
+func readProperties(path string) (interface{}, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if strings.HasPrefix(filepath.Base(path), ".env") {
+		// .env, .env.local
+		ext = ".env"
+	}
+	parse, ok := propertyParsers[ext]
+	if !ok {
+		return nil, fmt.Errorf("bootloader: unsupported properties file %s", path)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("bootloader: %v", err)
+	}
+	data, err := parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("bootloader: %s: %v", path, err)
+	}
+	if ext == ".env" {
+		vars := make(envVariables, len(data))
+		for name, v := range data {
+			vars[strings.ToUpper(name)] = v
+		}
+		return vars, nil
+	}
+	return data, nil
+}
+
+func parseJSON(b []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// setPath stores v in data under the dotted key, creating nested maps.
+func setPath(data map[string]interface{}, key string, v interface{}) error {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		part = strings.TrimSpace(part)
+		next, ok := data[part].(map[string]interface{})
+		if !ok {
+			if _, exists := data[part]; exists {
+				return fmt.Errorf("key %s redefines a value as a table", key)
+			}
+			next = make(map[string]interface{})
+			data[part] = next
+		}
+		data = next
+	}
+	data[strings.TrimSpace(parts[len(parts)-1])] = v
+	return nil
+}
+
+type line struct {
+	no     int
+	indent int
+	text   string
+}
+
+// readLines returns the non-blank lines of b that are not comments.
+func readLines(b []byte, comments string) []line {
+	var lines []line
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for no := 1; scanner.Scan(); no++ {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		text := strings.TrimLeft(raw, " \t")
+		if text == "" || strings.ContainsRune(comments, rune(text[0])) {
+			continue
+		}
+		lines = append(lines, line{no: no, indent: len(raw) - len(text), text: text})
+	}
+	return lines
+}
+
+// parseINI parses key=value or key: value pairs, with [section]
+// headers prefixing the keys that follow and trailing backslashes
+// continuing values on the next line.
+func parseINI(b []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	section := ""
+	lines := readLines(b, "#;!")
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		text := l.text
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: bad section %q", l.no, text)
+			}
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		for strings.HasSuffix(text, "\\") && i+1 < len(lines) {
+			i++
+			text = text[:len(text)-1] + lines[i].text
+		}
+		sep := strings.IndexAny(text, "=:")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key=value", l.no)
+		}
+		key := strings.TrimSpace(text[:sep])
+		if section != "" {
+			key = section + "." + key
+		}
+		data[key] = unquote(strings.TrimSpace(text[sep+1:]))
+	}
+	return data, nil
+}
+
+// parseEnv parses KEY=VALUE lines, optionally prefixed by export, into
+// a map of the variables.
+func parseEnv(b []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	for _, l := range readLines(b, "#") {
+		text := strings.TrimPrefix(l.text, "export ")
+		sep := strings.IndexByte(text, '=')
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", l.no)
+		}
+		data[strings.TrimSpace(text[:sep])] = unquote(strings.TrimSpace(text[sep+1:]))
+	}
+	return data, nil
+}
+
+// parseTOML parses [table] headers and key = value pairs whose values
+// are strings, numbers, booleans or single-line arrays of those.
+func parseTOML(b []byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	table := ""
+	for _, l := range readLines(b, "#") {
+		text := stripComment(l.text)
+		if strings.HasPrefix(text, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", l.no)
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: bad table %q", l.no, text)
+			}
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		}
+		sep := strings.IndexByte(text, '=')
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", l.no)
+		}
+		key := strings.Trim(strings.TrimSpace(text[:sep]), `"`)
+		if table != "" {
+			key = table + "." + key
+		}
+		v, err := parseScalar(strings.TrimSpace(text[sep+1:]), true)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.no, err)
+		}
+		if err := setPath(data, key, v); err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.no, err)
+		}
+	}
+	return data, nil
+}
+
+// parseYAML parses indented mappings and sequences of scalars,
+// flow sequences and mappings.
+func parseYAML(b []byte) (map[string]interface{}, error) {
+	lines := readLines(b, "#")
+	for i := range lines {
+		lines[i].text = stripComment(lines[i].text)
+	}
+	if len(lines) > 0 && lines[0].text == "---" {
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return make(map[string]interface{}), nil
+	}
+	p := &yamlParser{lines: lines}
+	v, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(lines) {
+		return nil, fmt.Errorf("line %d: bad indentation", lines[p.i].no)
+	}
+	data, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a mapping at the top level")
+	}
+	return data, nil
+}
+
+type yamlParser struct {
+	lines []line
+	i     int
+}
+
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isYAMLItem(p.lines[p.i].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	data := make(map[string]interface{})
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && !isYAMLItem(p.lines[p.i].text) {
+		l := p.lines[p.i]
+		sep := strings.Index(l.text+" ", ": ")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", l.no)
+		}
+		key := unquote(strings.TrimSpace(l.text[:sep]))
+		rest := ""
+		if sep+2 <= len(l.text) {
+			rest = strings.TrimSpace(l.text[sep+2:])
+		}
+		p.i++
+		if rest != "" {
+			v, err := parseScalar(rest, false)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", l.no, err)
+			}
+			data[key] = v
+			continue
+		}
+		// a nested block, sequences may share the indentation of their key
+		if p.i < len(p.lines) && (p.lines[p.i].indent > indent ||
+			p.lines[p.i].indent == indent && isYAMLItem(p.lines[p.i].text)) {
+			v, err := p.block(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			data[key] = v
+		} else {
+			data[key] = nil
+		}
+	}
+	return data, nil
+}
+
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	var items []interface{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && isYAMLItem(p.lines[p.i].text) {
+		l := p.lines[p.i]
+		rest := strings.TrimSpace(l.text[1:])
+		if rest == "" {
+			p.i++
+			if p.i >= len(p.lines) || p.lines[p.i].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			v, err := p.block(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		if strings.Contains(rest+" ", ": ") && !strings.HasPrefix(rest, "[") && !strings.HasPrefix(rest, `"`) && !strings.HasPrefix(rest, "'") {
+			// a mapping starting on the item line
+			itemIndent := indent + len(l.text) - len(rest)
+			p.lines[p.i] = line{no: l.no, indent: itemIndent, text: rest}
+			v, err := p.mapping(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		v, err := parseScalar(rest, false)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.no, err)
+		}
+		items = append(items, v)
+		p.i++
+	}
+	return items, nil
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// stripComment removes a trailing " #" comment outside of quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return strings.TrimSpace(s[:i])
+		}
+	}
+	return s
+}
+
+// parseScalar parses a quoted string, boolean, number, null or flow
+// sequence of TOML or YAML; anything else is returned as a plain string.
+func parseScalar(s string, toml bool) (interface{}, error) {
+	switch {
+	case s == "":
+		return "", nil
+	case s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad string %s", s)
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("bad string %s", s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			return nil, fmt.Errorf("bad array %s", s)
+		}
+		var items []interface{}
+		for _, item := range splitList(s[1 : len(s)-1]) {
+			v, err := parseScalar(item, toml)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case s[0] == '{':
+		return nil, fmt.Errorf("inline tables are not supported")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s == "null" || s == "~":
+		return nil, nil
+	}
+	if v, ok := parseNumber(s, toml); ok {
+		return v, nil
+	}
+	return s, nil
+}
+
+var (
+	decimalPattern = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	floatPattern   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)?(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+	tomlDigits     = regexp.MustCompile(`[0-9a-fA-F]_[0-9a-fA-F]`)
+)
+
+// parseNumber parses the decimal integers and floats of s. Numbers with
+// leading zeros, such as zip codes, are left to be strings. TOML also
+// allows 0x, 0o and 0b integers, underscores between digits, and inf
+// and nan; YAML spells these .inf and .nan.
+func parseNumber(s string, toml bool) (interface{}, bool) {
+	if toml && strings.Contains(s, "_") {
+		if !tomlDigits.MatchString(s) || strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") || strings.Contains(s, "__") {
+			return nil, false
+		}
+		s = strings.Replace(s, "_", "", -1)
+	}
+	if toml && len(s) > 2 && s[0] == '0' {
+		base := 0
+		switch s[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 0 {
+			i, err := strconv.ParseInt(s[2:], base, 64)
+			return i, err == nil
+		}
+	}
+	if decimalPattern.MatchString(s) {
+		i, err := strconv.ParseInt(s, 10, 64)
+		return i, err == nil
+	}
+	sign, special := 1.0, strings.TrimLeft(s, "+-")
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+	}
+	if toml {
+		switch special {
+		case "inf":
+			return math.Inf(int(sign)), true
+		case "nan":
+			return math.NaN(), true
+		}
+	} else {
+		switch special {
+		case ".inf", ".Inf", ".INF":
+			return math.Inf(int(sign)), true
+		case ".nan", ".NaN", ".NAN":
+			return math.NaN(), s == special
+		}
+	}
+	if strings.ContainsAny(s, ".eE") && floatPattern.MatchString(s) && strings.ContainsAny(s, "0123456789") {
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// splitList splits a comma-separated list outside of quotes and brackets.
+func splitList(s string) []string {
+	var (
+		items []string
+		quote byte
+		depth int
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// unquote removes the quotes around an INI or .env value.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		if s[0] == '"' {
+			if v, err := strconv.Unquote(s); err == nil {
+				return v
+			}
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
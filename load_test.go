@@ -0,0 +1,200 @@
+package bootloader
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_LoadProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"app.json": `{"db": {"host": "json", "port": 5432}}`,
+		"app.ini": `
+; comment
+[db]
+host = ini
+port = 5432
+`,
+		"app.properties": `
+# comment
+db.host=properties
+db.port: 5432
+`,
+		"app.env": `
+export DB_HOST="env"
+DB_PORT=5432
+`,
+		"app.toml": `
+title = "app" # comment
+[db]
+host = "toml"
+port = 5_432
+tags = ["a", "b"]
+`,
+		"app.yaml": `
+---
+title: app
+db:
+  host: "yaml" # comment
+  port: 5432
+  tags:
+  - a
+  - b
+servers:
+  - host: a
+    port: 1
+  - host: b
+    port: 2
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loader := newBootloader()
+		if err := loader.LoadProperties(path); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var cfg struct {
+			Host string
+			Port int
+		}
+		if err := loader.BindProperties("db", &cfg); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		expected := name[len("app."):]
+		if cfg.Host != expected || cfg.Port != 5432 {
+			t.Errorf("%s: unexpected config %+v", name, cfg)
+		}
+	}
+
+	if err := newBootloader().LoadProperties(filepath.Join(dir, "app.xml")); err == nil {
+		t.Errorf("expected an error for an unsupported extension")
+	}
+}
+
+func Test_ParseYAML(t *testing.T) {
+	data, err := parseYAML([]byte(`
+servers:
+  - host: a
+    port: 1
+  - host: b
+list: [1, "two"]
+empty:
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, ok := data["servers"].([]interface{})
+	if !ok || len(servers) != 2 {
+		t.Fatalf("unexpected servers %#v", data["servers"])
+	}
+	if first := servers[0].(map[string]interface{}); first["host"] != "a" || first["port"] != int64(1) {
+		t.Errorf("unexpected server %#v", first)
+	}
+	if list := data["list"].([]interface{}); len(list) != 2 || list[1] != "two" {
+		t.Errorf("unexpected list %#v", list)
+	}
+	if v, ok := data["empty"]; !ok || v != nil {
+		t.Errorf("unexpected empty %#v", v)
+	}
+
+	if _, err := parseYAML([]byte("a: 1\n  b: 2\n")); err == nil {
+		t.Errorf("expected an indentation error")
+	}
+}
+
+func Test_ParseScalar(t *testing.T) {
+	nan := func(v interface{}) bool {
+		f, ok := v.(float64)
+		return ok && math.IsNaN(f)
+	}
+	for _, c := range []struct {
+		in   string
+		toml bool
+		out  interface{}
+	}{
+		{"01234", false, "01234"},
+		{"1_0", false, "1_0"},
+		{"1_0", true, int64(10)},
+		{"1__0", true, "1__0"},
+		{"0x1f", true, int64(31)},
+		{"0x1f", false, "0x1f"},
+		{"0o17", true, int64(15)},
+		{"-42", false, int64(-42)},
+		{"1.5e3", false, 1500.0},
+		{".5", false, 0.5},
+		{"Nan", false, "Nan"},
+		{"inf", false, "inf"},
+		{"Infinity", true, "Infinity"},
+		{"-.inf", false, math.Inf(-1)},
+		{"-inf", true, math.Inf(-1)},
+		{"e5", false, "e5"},
+	} {
+		v, err := parseScalar(c.in, c.toml)
+		if err != nil || v != c.out {
+			t.Errorf("%q (toml %v): unexpected %#v, %v", c.in, c.toml, v, err)
+		}
+	}
+	if v, _ := parseScalar(".nan", false); !nan(v) {
+		t.Errorf("unexpected .nan %#v", v)
+	}
+	if v, _ := parseScalar("nan", true); !nan(v) {
+		t.Errorf("unexpected nan %#v", v)
+	}
+}
+
+func Test_LoadProperties_FlatKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".env")
+	err = ioutil.WriteFile(path, []byte("DB_PASSWORD=secret\nDB_PASSWORD_FILE=/run/secrets/db\nDB_MAX_CONNS=20\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader := newBootloader()
+	if err := loader.LoadProperties(path); err != nil {
+		t.Fatal(err)
+	}
+	var db struct {
+		Password     string
+		PasswordFile string `json:"password_file"`
+		MaxConns     int    `json:"max_conns"`
+	}
+	if err := loader.BindProperties("db", &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Password != "secret" || db.PasswordFile != "/run/secrets/db" || db.MaxConns != 20 {
+		t.Errorf("unexpected config %+v", db)
+	}
+
+	path = filepath.Join(dir, "app.properties")
+	if err := ioutil.WriteFile(path, []byte("a=1\na.b=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader = newBootloader()
+	if err := loader.LoadProperties(path); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := loader.GetProperty("a"); v != "1" {
+		t.Errorf("unexpected a %v", v)
+	}
+	if v, _ := loader.GetProperty("a.b"); v != "2" {
+		t.Errorf("unexpected a.b %v", v)
+	}
+}
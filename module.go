@@ -1,8 +1,23 @@
 package bootloader
 
+import "context"
+
 type Module interface {
 }
 
+type Phase string
+
+const (
+	PhaseCreate  Phase = "create"
+	PhaseMount   Phase = "mount"
+	PhaseStart   Phase = "start"
+	PhaseStop    Phase = "stop"
+	PhaseReload  Phase = "reload"
+	PhaseDestroy Phase = "destroy"
+
+	PhaseHealthCheck Phase = "healthcheck"
+)
+
 type OnCreater interface {
 	OnCreate()
 }
@@ -18,3 +33,47 @@ type OnDestroyer interface {
 type OnStarter interface {
 	OnStart()
 }
+
+// OnCreaterContext is the error-returning, context-aware form of OnCreater.
+type OnCreaterContext interface {
+	OnCreate(ctx context.Context) error
+}
+
+// OnMounterContext is the error-returning, context-aware form of OnMounter.
+type OnMounterContext interface {
+	OnMount(ctx context.Context) error
+}
+
+// OnStarterContext is the error-returning, context-aware form of OnStarter.
+type OnStarterContext interface {
+	OnStart(ctx context.Context) error
+}
+
+// OnDestroyerContext is the error-returning, context-aware form of OnDestroyer.
+type OnDestroyerContext interface {
+	OnDestroy(ctx context.Context) error
+}
+
+// OnStopper is notified when the container shuts down while the module's
+// start hook is still running, so that hooks which do not observe the
+// context (e.g. a blocking ListenAndServe) can be asked to return.
+type OnStopper interface {
+	OnStop(ctx context.Context) error
+}
+
+// OnReloader is notified when the container receives a reload request,
+// typically SIGHUP.
+type OnReloader interface {
+	OnReload(ctx context.Context) error
+}
+
+// OnHealthChecker reports whether a running module is healthy.
+type OnHealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+// OnPropertiesChanger is notified with the keys whose values changed
+// after the properties were reloaded and re-injected.
+type OnPropertiesChanger interface {
+	OnPropertiesChanged(changedKeys []string)
+}
@@ -0,0 +1,91 @@
+package bootloader
+
+import (
+	"sync"
+	"time"
+)
+
+// Option configures a single module when it is added to the container.
+type Option func(*options)
+
+type options struct {
+	timeouts  map[Phase]time.Duration
+	restart   RestartPolicy
+	name      string
+	params    []string
+	primary   bool
+	qualifier string
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Timeout overrides the container timeout of phase for the module.
+// A zero or negative duration disables the timeout.
+func Timeout(phase Phase, d time.Duration) Option {
+	return func(o *options) {
+		if o.timeouts == nil {
+			o.timeouts = make(map[Phase]time.Duration)
+		}
+		o.timeouts[phase] = d
+	}
+}
+
+func newTimeouts() *timeouts {
+	return &timeouts{data: make(map[Phase]time.Duration)}
+}
+
+type timeouts struct {
+	data  map[Phase]time.Duration
+	mutex sync.RWMutex
+}
+
+func (t *timeouts) get(phase Phase) time.Duration {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.data[phase]
+}
+
+func (t *timeouts) set(phase Phase, d time.Duration) {
+	t.mutex.Lock()
+	t.data[phase] = d
+	t.mutex.Unlock()
+}
+
+// Name registers the module returned by a provider function under name
+// instead of by type.
+func Name(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// ParamNames resolves the parameters of a provider function by module
+// name, in order. An empty name resolves the parameter by type.
+func ParamNames(names ...string) Option {
+	return func(o *options) {
+		o.params = names
+	}
+}
+
+// Primary marks the module as the one to inject when several
+// modules match a type.
+func Primary() Option {
+	return func(o *options) {
+		o.primary = true
+	}
+}
+
+// Qualifier distinguishes the module from other modules of the same type.
+// A field tagged `bloader:"auto,qualifier=name"` is only injected with
+// a module of that qualifier.
+func Qualifier(name string) Option {
+	return func(o *options) {
+		o.qualifier = name
+	}
+}
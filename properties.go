@@ -1,7 +1,11 @@
 package bootloader
 
 import (
+	"fmt"
+	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -11,17 +15,137 @@ type property struct {
 	value reflect.Value
 }
 
+// Priorities of the built-in property sources, from lowest to highest:
+// defaults, files, values set with SetProperties, the environment and
+// the command-line flags. Keys of a source override the keys of the
+// sources of lower priority; among sources of the same priority, the
+// first added loses.
+const (
+	PriorityDefaults     = 0
+	PriorityFiles        = 100
+	PriorityProgrammatic = 200
+	PriorityEnv          = 300
+	PriorityFlags        = 400
+)
+
+// Names of the built-in property sources. SetProperties feeds the
+// programmatic source and a file loaded with LoadProperties is the
+// source "file:" followed by its path.
+const (
+	SourceDefaults     = "defaults"
+	SourceProgrammatic = "programmatic"
+	SourceEnv          = "env"
+	SourceFlags        = "flags"
+)
+
+// MergeStrategy tells how a property source combines its nested maps
+// with the sources of lower priority.
+type MergeStrategy int
+
+const (
+	// MergeDeep overrides the lower sources key by key.
+	MergeDeep MergeStrategy = iota
+	// MergeReplace hides the keys of the lower sources below every
+	// key the source defines.
+	MergeReplace
+)
+
+// propertyLengthKey is the key below a slice holding its length, as in
+// servers.length next to servers.0, servers.1...
+const propertyLengthKey = "length"
+
+type propertySource struct {
+	name     string
+	priority int
+	merge    MergeStrategy
+	data     map[string]reflect.Value
+	// lookup and keys back the dynamic sources, such as the
+	// environment, in place of data.
+	lookup func(key string) (reflect.Value, bool)
+	keys   func() []string
+}
+
 func newProperties(prefix string) *properties {
-	return &properties{data: make(map[string]reflect.Value), prefix: prefix}
+	return &properties{prefix: prefix}
 }
 
 type properties struct {
-	data   map[string]reflect.Value
-	prefix string
-	mutex  sync.RWMutex
+	sources   []*propertySource
+	prefix    string
+	expandEnv bool
+	mutex     sync.RWMutex
+}
+
+// source returns the source name, adding an empty one if missing.
+func (p *properties) source(name string, priority int, merge MergeStrategy) *propertySource {
+	for _, s := range p.sources {
+		if s.name == name {
+			return s
+		}
+	}
+	s := &propertySource{name: name, priority: priority, merge: merge, data: make(map[string]reflect.Value)}
+	p.sources = append(p.sources, s)
+	p.sort()
+	return s
+}
+
+func (p *properties) sort() {
+	sort.SliceStable(p.sources, func(i, j int) bool {
+		return p.sources[i].priority < p.sources[j].priority
+	})
+}
+
+// add replaces the source name with the properties of data.
+func (p *properties) add(name string, priority int, merge MergeStrategy, data interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	s := p.source(name, priority, merge)
+	if s.priority != priority {
+		s.priority = priority
+		p.sort()
+	}
+	s.merge = merge
+	p.fill(s, data)
 }
 
+// replace replaces the properties of the source name, keeping its
+// priority and merge strategy.
+func (p *properties) replace(name string, data interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.fill(p.source(name, PriorityFiles, MergeDeep), data)
+}
+
+func (p *properties) fill(s *propertySource, data interface{}) {
+	if vars, ok := data.(envVariables); ok {
+		s.data = nil
+		s.lookup = func(key string) (reflect.Value, bool) {
+			if v, ok := vars[envName("", "_", key)]; ok {
+				return reflect.ValueOf(v), true
+			}
+			return zero, false
+		}
+		s.keys = func() []string {
+			names := make([]string, 0, len(vars))
+			for name := range vars {
+				names = append(names, name)
+			}
+			return envKeys("", "_", names, p.dataKeys())
+		}
+		return
+	}
+	s.data, s.lookup, s.keys = make(map[string]reflect.Value), nil, nil
+	p.walk(s.data, "", indirect(data))
+}
+
+// set merges the properties of data into the programmatic source.
 func (p *properties) set(data interface{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.walk(p.source(SourceProgrammatic, PriorityProgrammatic, MergeDeep).data, "", indirect(data))
+}
+
+func indirect(data interface{}) reflect.Value {
 	value, ok := data.(reflect.Value)
 	if !ok {
 		value = reflect.ValueOf(data)
@@ -29,34 +153,54 @@ func (p *properties) set(data interface{}) {
 	if value.Kind() == reflect.Ptr {
 		value = value.Elem()
 	}
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	p.walk("", value)
+	return value
 }
 
-func (p *properties) walk(dot string, data reflect.Value) {
-	if data.IsZero() {
-		return
-	}
-	if data.Kind() == reflect.Ptr {
+func (p *properties) walk(props map[string]reflect.Value, dot string, data reflect.Value) {
+	for data.Kind() == reflect.Ptr || data.Kind() == reflect.Interface {
+		if data.IsNil() {
+			return
+		}
 		data = data.Elem()
 	}
+	if !data.IsValid() || data.IsZero() {
+		return
+	}
 	dataType := data.Type()
 	if data.Kind() == reflect.Struct {
 		for i := 0; i < data.NumField(); i++ {
 			ft := dataType.Field(i)
 			fv := data.Field(i)
-			name := dot + "." + strings.ToLower(ft.Name)
-			p.data[p.prefix+name[1:]] = fv
-			p.walk(name, fv)
+			key, opts, skip := fieldKey(ft)
+			if skip {
+				continue
+			}
+			if squashed(opts) {
+				p.walk(props, dot, fv)
+				continue
+			}
+			name := dot + "." + key
+			props[p.prefix+name[1:]] = fv
+			p.walk(props, name, fv)
+		}
+	} else if data.Kind() == reflect.Slice || data.Kind() == reflect.Array {
+		if dataType.Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		length := dot + "." + propertyLengthKey
+		props[p.prefix+length[1:]] = reflect.ValueOf(data.Len())
+		for i := 0; i < data.Len(); i++ {
+			name := dot + "." + strconv.Itoa(i)
+			props[p.prefix+name[1:]] = data.Index(i)
+			p.walk(props, name, data.Index(i))
 		}
 	} else if data.Kind() == reflect.Map {
 		for _, k := range data.MapKeys() {
 			v := data.MapIndex(k)
 			if k.Kind() == reflect.String {
 				name := dot + "." + strings.ToLower(k.String())
-				p.data[p.prefix+name[1:]] = v
-				p.walk(name, v)
+				props[p.prefix+name[1:]] = v
+				p.walk(props, name, v)
 			}
 		}
 	}
@@ -65,10 +209,274 @@ func (p *properties) walk(dot string, data reflect.Value) {
 func (p *properties) value(name string) reflect.Value {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
-	if v, ok := p.data[p.prefix+strings.ToLower(name)]; ok {
-		return v
+	return p.raw(name)
+}
+
+func (p *properties) raw(name string) reflect.Value {
+	v, _ := p.find(strings.ToLower(name))
+	return v
+}
+
+// find returns the effective value of key and the source supplying it.
+func (p *properties) find(key string) (reflect.Value, *propertySource) {
+	for i := len(p.sources) - 1; i >= 0; i-- {
+		s := p.sources[i]
+		if v, ok := p.get(s, key); ok {
+			return v, s
+		}
+		if s.merge == MergeReplace && p.shadows(s, key) {
+			break
+		}
+	}
+	return zero, nil
+}
+
+func (p *properties) get(s *propertySource, key string) (reflect.Value, bool) {
+	if s.lookup != nil {
+		return s.lookup(key)
+	}
+	v, ok := s.data[p.prefix+key]
+	return v, ok
+}
+
+// shadows reports whether s defines a parent of key.
+func (p *properties) shadows(s *propertySource, key string) bool {
+	for i := strings.LastIndexByte(key, '.'); i > 0; i = strings.LastIndexByte(key[:i], '.') {
+		if _, ok := p.get(s, key[:i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the distinct keys of every source, including the keys
+// hidden by sources replacing their subtrees.
+func (p *properties) keys() []string {
+	seen := make(map[string]struct{})
+	var keys []string
+	for _, s := range p.sources {
+		var names []string
+		if s.keys != nil {
+			names = s.keys()
+		} else {
+			for key := range s.data {
+				names = append(names, key[len(p.prefix):])
+			}
+		}
+		for _, key := range names {
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// origin returns the name of the source supplying the value of key.
+func (p *properties) origin(key string) (string, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if _, s := p.find(strings.ToLower(key)); s != nil {
+		return s.name, true
+	}
+	return "", false
+}
+
+func (p *properties) setEnv(prefix, sep string) {
+	if sep == "" {
+		sep = "_"
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	s := p.source(SourceEnv, PriorityEnv, MergeDeep)
+	s.data = nil
+	s.lookup = func(key string) (reflect.Value, bool) {
+		if v, ok := os.LookupEnv(envName(prefix, sep, key)); ok {
+			return reflect.ValueOf(v), true
+		}
+		return zero, false
+	}
+	s.keys = func() []string {
+		return envKeys(prefix, sep, environNames(), p.dataKeys())
+	}
+}
+
+// envName maps the key db.username to the variable APP_DB_USERNAME.
+func envName(prefix, sep, key string) string {
+	name := strings.ToUpper(strings.Replace(key, ".", sep, -1))
+	if prefix != "" {
+		name = strings.ToUpper(prefix) + sep + name
+	}
+	return name
+}
+
+// environNames returns the names of the variables of the environment.
+func environNames() []string {
+	var names []string
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			names = append(names, kv[:i])
+		}
+	}
+	return names
+}
+
+// dataKeys returns the keys, and their parents, of the sources that are
+// not backed by variables.
+func (p *properties) dataKeys() map[string]struct{} {
+	known := make(map[string]struct{})
+	for _, s := range p.sources {
+		if s.lookup != nil {
+			continue
+		}
+		for key := range s.data {
+			key = key[len(p.prefix):]
+			for i := len(key); i > 0; i = strings.LastIndexByte(key[:i], '.') {
+				known[key[:i]] = struct{}{}
+			}
+		}
+	}
+	return known
+}
+
+// envKeys returns the keys of the variables names with the prefix. As
+// the separator "_" may also be part of a key, a variable is listed under
+// the longest key known from the other sources that maps back to it, and
+// is otherwise split at its first separator only: APP_DB_MAX_CONNS is
+// db.max_conns unless another source knows db.max.conns.
+func envKeys(prefix, sep string, names []string, known map[string]struct{}) []string {
+	if prefix != "" {
+		prefix = strings.ToUpper(prefix) + sep
+	}
+	var keys []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) {
+			continue
+		}
+		keys = append(keys, envKey(sep, name[len(prefix):], known))
+	}
+	return keys
+}
+
+// envKey returns the key of the variable name stripped of its prefix.
+func envKey(sep, name string, known map[string]struct{}) string {
+	upper, lower := strings.ToUpper(name), strings.ToLower(name)
+	lowerSep := strings.ToLower(sep)
+	exact, parent := "", ""
+	for key := range known {
+		v := envName("", sep, key)
+		if v == upper && (exact == "" || key < exact) {
+			exact = key
+		} else if (len(key) > len(parent) || len(key) == len(parent) && key < parent) &&
+			strings.HasPrefix(upper, v+strings.ToUpper(sep)) {
+			parent = key
+		}
+	}
+	if exact != "" {
+		return exact
+	}
+	if parent != "" {
+		rest := lower[len(envName("", sep, parent))+len(sep):]
+		if sep != "_" {
+			rest = strings.Replace(rest, lowerSep, ".", -1)
+		}
+		return parent + "." + rest
+	}
+	if sep != "_" {
+		return strings.Replace(lower, lowerSep, ".", -1)
+	}
+	if i := strings.Index(lower, lowerSep); i > 0 {
+		return lower[:i] + "." + lower[i+len(sep):]
+	}
+	return lower
+}
+
+func (p *properties) setExpandEnv(enabled bool) {
+	p.mutex.Lock()
+	p.expandEnv = enabled
+	p.mutex.Unlock()
+}
+
+// resolve returns the value of name with the ${key} and ${key:default}
+// placeholders of string values expanded, recursively.
+func (p *properties) resolve(name string, stack []string) (reflect.Value, error) {
+	v := p.raw(name)
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.String || !strings.Contains(v.String(), "$") {
+		return v, nil
+	}
+	s, err := p.expand(v.String(), append(stack, strings.ToLower(name)))
+	if err != nil {
+		return zero, err
+	}
+	return reflect.ValueOf(s).Convert(v.Type()), nil
+}
+
+// expand replaces the placeholders of s; stack holds the keys being
+// expanded to detect cycles. Only ${...} is expanded and "$${" stands
+// for a literal "${"; any other "$" is kept as is.
+func (p *properties) expand(s string, stack []string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '$':
+			if i+2 < len(s) && s[i+2] == '{' {
+				b.WriteString("${")
+				i += 2
+			} else {
+				b.WriteByte('$')
+			}
+			continue
+		case '{':
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+		ref, w := getShellName(s[i+1:])
+		if ref == "" {
+			return "", fmt.Errorf("bootloader: property %s, bad placeholder in %q", stack[len(stack)-1], s)
+		}
+		i += w
+		key, def, hasDef := parsePropertyKey(ref)
+		val, err := p.placeholder(key, def, hasDef, stack)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+	}
+	return b.String(), nil
+}
+
+func (p *properties) placeholder(key, def string, hasDef bool, stack []string) (string, error) {
+	lower := strings.ToLower(key)
+	for i, k := range stack {
+		if k == lower {
+			return "", fmt.Errorf("bootloader: property cycle %s", strings.Join(append(stack[i:], lower), " -> "))
+		}
+	}
+	if p.raw(key) != zero {
+		v, err := p.resolve(key, stack)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(v.Interface()), nil
+	}
+	if p.expandEnv {
+		if env, ok := os.LookupEnv(key); ok {
+			return env, nil
+		}
+	}
+	if hasDef {
+		return p.expand(def, stack)
 	}
-	return zero
+	return "", fmt.Errorf("bootloader: property %s, undefined reference ${%s}", stack[len(stack)-1], key)
 }
 
 var zero reflect.Value
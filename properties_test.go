@@ -1,8 +1,15 @@
 package bootloader
 
 import (
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_a(t *testing.T) {
@@ -34,7 +41,7 @@ func Test_a(t *testing.T) {
 	p.set(c)
 	p.set(users)
 
-	log.Println(p.data)
+	log.Println(p.keys())
 
 	if int(p.value("port").Int()) != c.Port {
 		t.Errorf("port not found")
@@ -49,3 +56,348 @@ func Test_a(t *testing.T) {
 	}
 
 }
+
+type serverModule struct {
+	Port    int           `bloader:"${server.port:8080}"`
+	Host    string        `bloader:"${server.host:localhost}"`
+	Timeout time.Duration `bloader:"$server.timeout"`
+	Tags    []string      `bloader:"${server.tags:a,b}"`
+}
+
+func Test_InjectProperty_Convert(t *testing.T) {
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"server": map[string]string{
+			"port":    "9090",
+			"timeout": "3s",
+		},
+	})
+	m := &serverModule{}
+	loader.AddByAuto(m)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Port != 9090 || m.Host != "localhost" || m.Timeout != 3*time.Second {
+		t.Errorf("unexpected module %+v", m)
+	}
+	if len(m.Tags) != 2 || m.Tags[1] != "b" {
+		t.Errorf("unexpected tags %v", m.Tags)
+	}
+}
+
+func Test_Properties_Expand(t *testing.T) {
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "localhost",
+			"port": 5432,
+			"url":  "postgres://${db.host}:${db.port}/${db.name:app}",
+		},
+		"price": "$$5",
+		"pw":    "pa$$word$",
+		"tmpl":  "$${db.host}",
+		"a":     "${b}",
+		"b":     "${a}",
+		"bad":   "${missing}",
+		"home":  "${BOOTLOADER_TEST_HOME}",
+	})
+	if v, _ := loader.GetProperty("db.url"); v != "postgres://localhost:5432/app" {
+		t.Errorf("unexpected url %v", v)
+	}
+	for key, expected := range map[string]string{"price": "$$5", "pw": "pa$$word$", "tmpl": "${db.host}"} {
+		if v, _ := loader.GetProperty(key); v != expected {
+			t.Errorf("%s: unexpected value %v", key, v)
+		}
+	}
+	if _, ok := loader.GetProperty("a"); ok {
+		t.Errorf("cycle not detected")
+	}
+	assertPanic(t, "property cycle a -> b -> a", func() { loader.MuestGetProperty("a") })
+	assertPanic(t, "undefined reference ${missing}", func() { loader.MuestGetProperty("bad") })
+
+	os.Setenv("BOOTLOADER_TEST_HOME", "/home/app")
+	defer os.Unsetenv("BOOTLOADER_TEST_HOME")
+	if _, ok := loader.GetProperty("home"); ok {
+		t.Errorf("environment expanded without SetExpandEnv")
+	}
+	loader.SetExpandEnv(true)
+	if v, _ := loader.GetProperty("home"); v != "/home/app" {
+		t.Errorf("unexpected home %v", v)
+	}
+}
+
+func assertPanic(t *testing.T, msg string, fn func()) {
+	t.Helper()
+	defer func() {
+		err := recover()
+		if err == nil || !strings.Contains(fmt.Sprint(err), msg) {
+			t.Errorf("panic %v, expected %q", err, msg)
+		}
+	}()
+	fn()
+}
+
+func Test_Properties_Env(t *testing.T) {
+	os.Setenv("BLTEST_DB_PORT", "6543")
+	os.Setenv("BLTEST_DB_USERNAME", "env")
+	os.Setenv("BLTEST2__DB__MAX_CONNS", "20")
+	defer os.Unsetenv("BLTEST_DB_PORT")
+	defer os.Unsetenv("BLTEST_DB_USERNAME")
+	defer os.Unsetenv("BLTEST2__DB__MAX_CONNS")
+
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"db": map[string]interface{}{"port": 5432},
+	})
+	if v, _ := loader.GetProperty("db.port"); v != 5432 {
+		t.Errorf("environment overlaid before EnableEnv: %v", v)
+	}
+	loader.EnableEnv("BLTEST", "")
+	var cfg struct {
+		Port     int
+		Username string
+	}
+	if err := loader.BindProperties("db", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 6543 || cfg.Username != "env" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	loader = newBootloader()
+	loader.EnableEnv("bltest2", "__")
+	var db struct {
+		MaxConns int `json:"max_conns"`
+	}
+	if err := loader.BindProperties("db", &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.MaxConns != 20 {
+		t.Errorf("unexpected config %+v", db)
+	}
+}
+
+func Test_Properties_EnvKeys(t *testing.T) {
+	os.Setenv("BLKEYS_DB_MAX_CONNS", "20")
+	os.Setenv("BLKEYS_POOL_IDLE_TIMEOUT", "1s")
+	defer os.Unsetenv("BLKEYS_DB_MAX_CONNS")
+	defer os.Unsetenv("BLKEYS_POOL_IDLE_TIMEOUT")
+
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{
+		"pool": map[string]interface{}{"idle": map[string]interface{}{"timeout": "5s"}},
+	})
+	loader.EnableEnv("BLKEYS", "")
+	var db map[string]string
+	if err := loader.BindProperties("db", &db); err != nil {
+		t.Fatal(err)
+	}
+	if len(db) != 1 || db["max_conns"] != "20" {
+		t.Errorf("unexpected db %v", db)
+	}
+	var pool map[string]map[string]string
+	if err := loader.BindProperties("pool", &pool); err != nil {
+		t.Fatal(err)
+	}
+	if len(pool) != 1 || pool["idle"]["timeout"] != "1s" {
+		t.Errorf("unexpected pool %v", pool)
+	}
+}
+
+func Test_Properties_Sources(t *testing.T) {
+	os.Setenv("BLSRC_DB_USER", "env")
+	defer os.Unsetenv("BLSRC_DB_USER")
+
+	loader := newBootloader()
+	err := loader.AddPropertySource(SourceDefaults, PriorityDefaults, map[string]interface{}{
+		"db":  map[string]interface{}{"host": "localhost", "port": 5432, "user": "root"},
+		"log": map[string]interface{}{"level": "info", "format": "text"},
+	}, MergeDeep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loader.SetProperties(map[string]interface{}{
+		"db": map[string]interface{}{"host": "db.local"},
+	})
+	loader.AddPropertySource("override", PriorityFiles, map[string]interface{}{
+		"log": map[string]interface{}{"level": "debug"},
+	}, MergeReplace)
+	loader.EnableEnv("BLSRC", "")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := loader.ParseFlags(fs, []string{"--set", "db.port=6000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, source := range map[string]string{
+		"db.host":    SourceProgrammatic,
+		"db.port":    SourceFlags,
+		"db.user":    SourceEnv,
+		"log.level":  "override",
+		"log.format": "",
+	} {
+		got, ok := loader.PropertySource(key)
+		if got != source || ok != (source != "") {
+			t.Errorf("%s: unexpected source %q", key, got)
+		}
+	}
+
+	var db struct {
+		Host string
+		Port int
+		User string
+	}
+	if err := loader.BindProperties("db", &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Host != "db.local" || db.Port != 6000 || db.User != "env" {
+		t.Errorf("unexpected config %+v", db)
+	}
+	var logging map[string]string
+	if err := loader.BindProperties("log", &logging); err != nil {
+		t.Fatal(err)
+	}
+	if len(logging) != 1 || logging["level"] != "debug" {
+		t.Errorf("unexpected log %v", logging)
+	}
+
+	// Replacing a source keeps its position.
+	loader.AddPropertySource(SourceDefaults, PriorityDefaults, map[string]interface{}{
+		"db": map[string]interface{}{"name": "app"},
+	}, MergeDeep)
+	if v, _ := loader.GetProperty("db.name"); v != "app" {
+		t.Errorf("unexpected db.name %v", v)
+	}
+	if _, ok := loader.GetProperty("log.format"); ok {
+		t.Errorf("replaced source still visible")
+	}
+	if err := loader.AddPropertySource("bad", 0, 42, MergeDeep); err == nil {
+		t.Errorf("expected an error for a scalar source")
+	}
+}
+
+type baseConfig struct {
+	Name string `yaml:"app_name"`
+}
+
+type tunedConfig struct {
+	baseConfig `bloader:",squash"`
+	MaxConns   int               `json:"max_conns"`
+	Secret     string            `json:"-"`
+	Level      string            `bloader:"log_level" json:"level"`
+	Extra      map[string]string `yaml:",inline"`
+	Timeout    time.Duration
+}
+
+func Test_Properties_FieldTags(t *testing.T) {
+	loader := newBootloader()
+	in := tunedConfig{
+		baseConfig: baseConfig{Name: "app"},
+		MaxConns:   10,
+		Secret:     "s3cret",
+		Level:      "debug",
+		Extra:      map[string]string{"region": "eu"},
+		Timeout:    time.Second,
+	}
+	loader.SetProperties(map[string]interface{}{"tuned": in})
+
+	for key, expected := range map[string]interface{}{
+		"tuned.app_name":  "app",
+		"tuned.max_conns": 10,
+		"tuned.log_level": "debug",
+		"tuned.region":    "eu",
+		"tuned.timeout":   time.Second,
+	} {
+		if v, _ := loader.GetProperty(key); v != expected {
+			t.Errorf("%s: unexpected value %v", key, v)
+		}
+	}
+	for _, key := range []string{"tuned.secret", "tuned.maxconns", "tuned.baseconfig", "tuned.extra"} {
+		if _, ok := loader.GetProperty(key); ok {
+			t.Errorf("%s: unexpected property", key)
+		}
+	}
+
+	var out struct {
+		baseConfig `bloader:",squash"`
+		MaxConns   int    `json:"max_conns"`
+		Level      string `bloader:"log_level"`
+	}
+	if err := loader.BindProperties("tuned", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "app" || out.MaxConns != 10 || out.Level != "debug" {
+		t.Errorf("unexpected config %+v", out)
+	}
+}
+
+func Test_Properties_ProgrammaticOverFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.json")
+	if err := ioutil.WriteFile(path, []byte(`{"port": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := newBootloader()
+	loader.SetProperties(map[string]interface{}{"port": 2})
+	loader.LoadProperties(path)
+	loader.SetProperties(map[string]interface{}{"port": 3})
+	if v, _ := loader.GetProperty("port"); v != 3 {
+		t.Errorf("unexpected port %v", v)
+	}
+
+	loader = newBootloader()
+	loader.LoadProperties(path)
+	loader.SetProperties(map[string]interface{}{"port": 2})
+	if v, _ := loader.GetProperty("port"); v != 2 {
+		t.Errorf("unexpected port %v", v)
+	}
+	if source, _ := loader.PropertySource("port"); source != SourceProgrammatic {
+		t.Errorf("unexpected source %s", source)
+	}
+}
+
+type layeredDB struct {
+	Host string
+	Port int
+}
+
+type layeredModule struct {
+	DB   layeredDB              `bloader:"$db"`
+	Port int                    `bloader:"$db.port"`
+	M    map[string]interface{} `bloader:"$m"`
+}
+
+func Test_Properties_LayeredInjection(t *testing.T) {
+	os.Setenv("BLLAYER_DB_PORT", "9999")
+	defer os.Unsetenv("BLLAYER_DB_PORT")
+
+	loader := newBootloader()
+	loader.SetProperties(&struct{ DB layeredDB }{DB: layeredDB{Host: "localhost", Port: 1}})
+	loader.AddPropertySource(SourceDefaults, PriorityDefaults, map[string]interface{}{
+		"m": map[string]interface{}{"a": "1", "b": "2"},
+	}, MergeDeep)
+	loader.EnableEnv("BLLAYER", "")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := loader.ParseFlags(fs, []string{"--set", "m.a=flag"}); err != nil {
+		t.Fatal(err)
+	}
+	m := &layeredModule{}
+	loader.AddByAuto(m)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if m.DB.Host != "localhost" || m.DB.Port != 9999 || m.Port != 9999 {
+		t.Errorf("unexpected db %+v, port %d", m.DB, m.Port)
+	}
+	if len(m.M) != 2 || m.M["a"] != "flag" || m.M["b"] != "2" {
+		t.Errorf("unexpected map %v", m.M)
+	}
+	db, _ := loader.GetProperty("db")
+	if v, _ := db.(map[string]interface{}); v["host"] != "localhost" || v["port"] != "9999" {
+		t.Errorf("unexpected db property %v", db)
+	}
+}
@@ -0,0 +1,210 @@
+package bootloader
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func newProvider(fn interface{}, opts []Option) (*provider, error) {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func {
+		return nil, fmt.Errorf("bootloader: Provide expects a function, got %T", fn)
+	}
+	p := &provider{fn: rv, opts: opts, o: newOptions(opts)}
+	rt := rv.Type()
+	if rt.IsVariadic() {
+		return nil, fmt.Errorf("bootloader: provider %s, variadic functions are not supported", p.Name())
+	}
+	if rt.NumOut() < 1 || rt.NumOut() > 2 || (rt.NumOut() == 2 && rt.Out(1) != errorType) {
+		return nil, fmt.Errorf("bootloader: provider %s, expected to return a module and an optional error", p.Name())
+	}
+	if len(p.o.params) > rt.NumIn() {
+		return nil, fmt.Errorf("bootloader: provider %s, %d parameter names for %d parameters", p.Name(), len(p.o.params), rt.NumIn())
+	}
+	return p, nil
+}
+
+// provider is a constructor function waiting for its parameters.
+type provider struct {
+	fn   reflect.Value
+	opts []Option
+	o    *options
+}
+
+func (p *provider) Name() string {
+	return runtime.FuncForPC(p.fn.Pointer()).Name()
+}
+
+func (p *provider) paramName(i int) string {
+	if i < len(p.o.params) {
+		return p.o.params[i]
+	}
+	return ""
+}
+
+// resolve finds the modules for the parameters of p, returning the index
+// of the first parameter that cannot be resolved, or -1. A parameter
+// resolved by type also waits while one of the pending providers returns
+// a module of that type.
+func (p *provider) resolve(g *group, pending []*provider) ([]*wrappedModule, int, error) {
+	rt := p.fn.Type()
+	params := make([]*wrappedModule, rt.NumIn())
+	for i := range params {
+		var (
+			m   *wrappedModule
+			err error
+		)
+		if name := p.paramName(i); name != "" {
+			m = g.FindByName(name)
+			if m != nil && !m.rt.AssignableTo(rt.In(i)) {
+				m = nil
+			}
+		} else if p.waits(rt.In(i), pending) {
+			return nil, i, nil
+		} else {
+			m, err = g.FindByType(rt.In(i), "")
+		}
+		if err != nil {
+			return nil, i, fmt.Errorf("bootloader: provider %s, parameter %d, %w", p.Name(), i, err)
+		}
+		if m == nil {
+			return nil, i, nil
+		}
+		params[i] = m
+	}
+	return params, -1, nil
+}
+
+// waits reports whether another pending provider returns a module
+// assignable to tp.
+func (p *provider) waits(tp reflect.Type, pending []*provider) bool {
+	for _, q := range pending {
+		if q != p && q.fn.Type().Out(0).AssignableTo(tp) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify resolves the parameters of p again against every module added,
+// returning an AmbiguityError if a module added after the invocation
+// would have been resolved instead of params.
+func (p *provider) verify(g *group, params []*wrappedModule) error {
+	found, _, err := p.resolve(g, nil)
+	if err != nil || found == nil {
+		return err
+	}
+	for i, m := range found {
+		if m != params[i] {
+			err := newAmbiguityError(p.fn.Type().In(i), []*wrappedModule{params[i], m})
+			return fmt.Errorf("bootloader: provider %s, parameter %d, %w", p.Name(), i, err)
+		}
+	}
+	return nil
+}
+
+// Provide registers a constructor function whose parameters are resolved
+// from the container by type, or by name with ParamNames. The function is
+// invoked once all of its parameters exist, and no pending provider returns
+// a module for a parameter resolved by type, and the module it returns is
+// added by type, or by name with Name.
+func (loader *bootloader) Provide(fn interface{}, opts ...Option) error {
+	p, err := newProvider(fn, opts)
+	if err != nil {
+		return err
+	}
+	loader.providersMutex.Lock()
+	loader.providers = append(loader.providers, p)
+	loader.providersMutex.Unlock()
+	return loader.provide()
+}
+
+// provide invokes the pending providers whose parameters can be resolved.
+func (loader *bootloader) provide() error {
+	for {
+		p, params, err := loader.nextProvider()
+		if err != nil {
+			return loader.fail(err)
+		}
+		if p == nil {
+			return nil
+		}
+		if err := loader.invokeProvider(p, params); err != nil {
+			return err
+		}
+	}
+}
+
+// nextProvider removes and returns the first provider whose parameters
+// can be resolved, or whose resolution fails.
+func (loader *bootloader) nextProvider() (*provider, []*wrappedModule, error) {
+	loader.providersMutex.Lock()
+	defer loader.providersMutex.Unlock()
+	for i, p := range loader.providers {
+		params, missing, err := p.resolve(loader.g, loader.providers)
+		if missing < 0 || err != nil {
+			loader.providers = append(loader.providers[:i], loader.providers[i+1:]...)
+			return p, params, err
+		}
+	}
+	return nil, nil, nil
+}
+
+func (loader *bootloader) invokeProvider(p *provider, params []*wrappedModule) error {
+	args := make([]reflect.Value, len(params))
+	for i, m := range params {
+		args[i] = m.rv
+	}
+	loader.log.Println("bootloader: provide", p.Name())
+	out := p.fn.Call(args)
+	if len(out) == 2 && !out[1].IsNil() {
+		return loader.fail(fmt.Errorf("bootloader: provider %s, %w", p.Name(), out[1].Interface().(error)))
+	}
+	if isNil(out[0]) {
+		return loader.fail(fmt.Errorf("bootloader: provider %s returned nil", p.Name()))
+	}
+	wrapped := loader.wrap(out[0].Interface(), p.opts)
+	wrapped.params = params
+	wrapped.provider = p
+	return loader.add(p.o.name, wrapped)
+}
+
+// verifyProviders panics if a provider is still waiting for its parameters,
+// or if the parameters of an invoked provider became ambiguous.
+func (loader *bootloader) verifyProviders() {
+	loader.providersMutex.Lock()
+	defer loader.providersMutex.Unlock()
+	for _, p := range loader.providers {
+		_, missing, err := p.resolve(loader.g, nil)
+		if err != nil {
+			panic(err)
+		}
+		if missing >= 0 {
+			param := p.fn.Type().In(missing).String()
+			if name := p.paramName(missing); name != "" {
+				param = name
+			}
+			panic(fmt.Errorf("bootloader: provider %s, parameter %d (%s) not found", p.Name(), missing, param))
+		}
+		panic(fmt.Errorf("bootloader: provider %s waits for the modules of another provider", p.Name()))
+	}
+	for _, m := range loader.g.List() {
+		if m.provider == nil {
+			continue
+		}
+		if err := m.provider.verify(loader.g, m.params); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package bootloader
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type providedConfig struct {
+	DSN string
+}
+
+type providedDB struct {
+	dsn string
+}
+
+type providedService struct {
+	db      *providedDB
+	replica *providedDB
+}
+
+func Test_Bootloader_Provide(t *testing.T) {
+	loader := newBootloader()
+	err := loader.Provide(func(db *providedDB, replica *providedDB) *providedService {
+		return &providedService{db: db, replica: replica}
+	}, ParamNames("", "replica"), Name("service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loader.Provide(func(cfg *providedConfig) (*providedDB, error) {
+		return &providedDB{dsn: cfg.DSN}, nil
+	}, Primary())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loader.Get("service"); err == nil {
+		t.Fatal("provider invoked before its parameters exist")
+	}
+	loader.Add("replica", &providedDB{dsn: "replica"})
+	loader.AddByAuto(&providedConfig{DSN: "primary"})
+
+	x, err := loader.Get("service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := x.(*providedService)
+	if svc.db == nil || svc.db.dsn != "primary" || svc.replica == nil || svc.replica.dsn != "replica" {
+		t.Errorf("unexpected service %+v", svc)
+	}
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, info := range loader.Modules() {
+		if info.Name != "service" {
+			continue
+		}
+		found = true
+		deps := info.Dependencies
+		if len(deps) != 2 || deps[0].Field != "param[0]" || deps[1].Field != "param[1]" || deps[1].Tag != "replica" ||
+			len(deps[1].Modules) != 1 || !strings.HasSuffix(deps[1].Modules[0], "providedDB") {
+			t.Errorf("unexpected dependencies %+v", deps)
+		}
+	}
+	if !found {
+		t.Errorf("service missing from Modules")
+	}
+}
+
+func Test_Bootloader_ProvideError(t *testing.T) {
+	loader := newBootloader()
+	errOpen := errors.New("open failed")
+	err := loader.Provide(func() (*providedDB, error) {
+		return nil, errOpen
+	})
+	if !errors.Is(err, errOpen) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := loader.Provide("not a function"); err == nil {
+		t.Errorf("expected error for a non-function provider")
+	}
+}
+
+func Test_Bootloader_ProvideUnresolved(t *testing.T) {
+	loader := newBootloader()
+	loader.Provide(func(cfg *providedConfig) *providedDB {
+		return &providedDB{}
+	})
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Run to panic on an unresolved provider")
+		}
+	}()
+	loader.Run()
+}
+
+func Test_Bootloader_ProvideAmbiguous(t *testing.T) {
+	loader := newBootloader()
+	loader.Provide(func(db *providedDB) *providedService {
+		return &providedService{db: db}
+	})
+	loader.Add("replica", &providedDB{dsn: "replica"})
+	loader.Add("main", &providedDB{dsn: "main"}, Primary())
+	defer func() {
+		err, _ := recover().(error)
+		var aerr *AmbiguityError
+		if !errors.As(err, &aerr) || len(aerr.Candidates) != 2 || aerr.Candidates[0] != "replica" {
+			t.Errorf("unexpected panic %v", err)
+		}
+	}()
+	loader.Run()
+	t.Errorf("Run did not fail")
+}
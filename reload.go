@@ -0,0 +1,230 @@
+package bootloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileSourcePrefix = "file:"
+
+// ReloadProperties reads the files loaded by LoadProperties again. If
+// any property changed, the property fields of the injected modules are
+// set to their new values and the OnPropertiesChanger modules are
+// notified. Fields tagged static keep their startup values.
+//
+// Nothing changes if a file cannot be read or a field cannot be set.
+// The fields are set while holding PropertyLock: a running module that
+// reads them takes the lock to see the values of a single reload, or
+// copies them in OnPropertiesChanged under a lock of its own.
+func (loader *bootloader) ReloadProperties() error {
+	paths := loader.props.files()
+	data := make([]interface{}, len(paths))
+	for i, path := range paths {
+		d, err := readProperties(path)
+		if err != nil {
+			return err
+		}
+		data[i] = d
+	}
+	return loader.updateProperties(func() {
+		for i, path := range paths {
+			loader.props.replace(fileSourcePrefix+path, data[i])
+		}
+	})
+}
+
+// WatchProperties polls the files loaded by LoadProperties every
+// interval and reloads the properties when one of them changes, until
+// the container stops.
+func (loader *bootloader) WatchProperties(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		stamps := loader.props.stamps()
+		for {
+			select {
+			case <-loader.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := loader.props.stamps()
+			if reflect.DeepEqual(stamps, current) {
+				continue
+			}
+			stamps = current
+			loader.log.Println("bootloader: properties changed, reloading")
+			if err := loader.ReloadProperties(); err != nil {
+				loader.log.Println(err)
+			}
+		}
+	}()
+}
+
+// PropertyLock returns the lock that ReloadProperties holds while it
+// sets the property fields of the modules.
+func (loader *bootloader) PropertyLock() sync.Locker {
+	return loader.fieldsMutex.RLocker()
+}
+
+type propertyUpdate struct {
+	f *wrappedField
+	v reflect.Value
+}
+
+// updateProperties applies a change of the property sources, then
+// re-injects and notifies the modules. The sources are restored if a
+// field cannot take its new value.
+func (loader *bootloader) updateProperties(apply func()) error {
+	loader.reloadMutex.Lock()
+	defer loader.reloadMutex.Unlock()
+	props := loader.props
+	saved := props.snapshot()
+	before := props.leafValues()
+	apply()
+	changed := changedKeys(before, props.leafValues())
+	if len(changed) == 0 {
+		return nil
+	}
+
+	var updates []propertyUpdate
+	modules := loader.g.DependencyOrder()
+	for _, m := range modules {
+		if !m.Injected() {
+			continue
+		}
+		for _, f := range m.fields {
+			if f.static || !strings.HasPrefix(f.key, "$") {
+				continue
+			}
+			v, err := loader.propertyValue(f)
+			if err == nil && v == zero && !f.optional {
+				err = fmt.Errorf("property %s not found", f.key[1:])
+			}
+			if err != nil {
+				props.restore(saved)
+				return fmt.Errorf("bootloader: Module %s, FiledName:%s, %v", m.Path(), f.name, err)
+			}
+			if v == zero {
+				v = reflect.Zero(f.rt)
+			}
+			if !reflect.DeepEqual(f.rv.Interface(), v.Interface()) {
+				updates = append(updates, propertyUpdate{f: f, v: v})
+			}
+		}
+	}
+	loader.fieldsMutex.Lock()
+	for _, u := range updates {
+		u.f.SetValue(u.v)
+	}
+	loader.fieldsMutex.Unlock()
+	loader.log.Println("bootloader: properties changed", changed)
+
+	var err error
+	for _, m := range modules {
+		changer, _ := m.rv.Interface().(OnPropertiesChanger)
+		if changer == nil || !m.Injected() {
+			continue
+		}
+		nerr := m.invoke(loader.ctx, PhaseReload, func(ctx context.Context) error {
+			changer.OnPropertiesChanged(changed)
+			return nil
+		})
+		if nerr != nil {
+			loader.log.Println(nerr)
+			if err == nil {
+				err = nerr
+			}
+		}
+	}
+	return err
+}
+
+// changedKeys returns the sorted keys whose values differ.
+func changedKeys(before, after map[string]interface{}) []string {
+	var keys []string
+	for key, v := range before {
+		if w, ok := after[key]; !ok || !reflect.DeepEqual(v, w) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// files returns the paths of the files loaded by LoadProperties.
+func (p *properties) files() []string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	var paths []string
+	for _, s := range p.sources {
+		if strings.HasPrefix(s.name, fileSourcePrefix) {
+			paths = append(paths, s.name[len(fileSourcePrefix):])
+		}
+	}
+	return paths
+}
+
+// stamps returns the modification time and size of the loaded files.
+func (p *properties) stamps() map[string][2]int64 {
+	stamps := make(map[string][2]int64)
+	for _, path := range p.files() {
+		if fi, err := os.Stat(path); err == nil {
+			stamps[path] = [2]int64{fi.ModTime().UnixNano(), fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// snapshot copies the sources so that restore can undo an update.
+func (p *properties) snapshot() []propertySource {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	saved := make([]propertySource, len(p.sources))
+	for i, s := range p.sources {
+		saved[i] = *s
+	}
+	return saved
+}
+
+func (p *properties) restore(saved []propertySource) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.sources = make([]*propertySource, len(saved))
+	for i := range saved {
+		s := saved[i]
+		p.sources[i] = &s
+	}
+}
+
+// leafValues returns the effective values of the properties that are
+// neither structs nor maps.
+func (p *properties) leafValues() map[string]interface{} {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	values := make(map[string]interface{})
+	for _, key := range p.keys() {
+		v, _ := p.find(key)
+		for v.Kind() == reflect.Interface && !v.IsNil() {
+			v = v.Elem()
+		}
+		if !v.IsValid() || !v.CanInterface() || v.Kind() == reflect.Struct || v.Kind() == reflect.Map {
+			continue
+		}
+		values[key] = v.Interface()
+	}
+	return values
+}
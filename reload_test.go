@@ -0,0 +1,105 @@
+package bootloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type reloadedModule struct {
+	Level   string `bloader:"$log.level"`
+	Port    int    `bloader:"$server.port,static"`
+	Verbose bool   `bloader:"$log.verbose,optional"`
+	changed chan []string
+}
+
+func (m *reloadedModule) OnPropertiesChanged(changedKeys []string) {
+	m.changed <- changedKeys
+}
+
+func Test_ReloadProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bootloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"log": {"level": "info", "verbose": true}, "server": {"port": 80}}`)
+
+	loader := newBootloader().(*bootloader)
+	if err := loader.LoadProperties(path); err != nil {
+		t.Fatal(err)
+	}
+	m := &reloadedModule{changed: make(chan []string, 1)}
+	loader.Add("reloaded", m)
+	if err := loader.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Shutdown()
+	waitStarted(t, loader)
+
+	// a running reader sees consistent values under PropertyLock
+	stop := make(chan struct{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		lock := loader.PropertyLock()
+		for {
+			lock.Lock()
+			level, verbose := m.Level, m.Verbose
+			lock.Unlock()
+			if level == "debug" && verbose {
+				t.Errorf("mixed values %s %v", level, verbose)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	write(`{"log": {"level": "debug"}, "server": {"port": 8080}}`)
+	err = loader.ReloadProperties()
+	close(stop)
+	<-read
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Level != "debug" || m.Port != 80 || m.Verbose {
+		t.Errorf("unexpected module %+v", m)
+	}
+	if keys := <-m.changed; strings.Join(keys, ",") != "log.level,log.verbose,server.port" {
+		t.Errorf("unexpected changed keys %v", keys)
+	}
+
+	write(`{"server": {"port": 8080}}`)
+	if err := loader.ReloadProperties(); err == nil {
+		t.Errorf("expected an error for a missing property")
+	}
+	if v, _ := loader.GetProperty("log.level"); v != "debug" || m.Level != "debug" {
+		t.Errorf("failed reload applied: %v %+v", v, m)
+	}
+	if err := loader.ReloadProperties(); err == nil {
+		t.Errorf("expected the error again")
+	}
+
+	loader.WatchProperties(10 * time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	write(`{"log": {"level": "warn"}, "server": {"port": 8080}}`)
+	select {
+	case keys := <-m.changed:
+		if len(keys) != 1 || keys[0] != "log.level" || m.Level != "warn" {
+			t.Errorf("unexpected watch reload %v %+v", keys, m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("file change not detected")
+	}
+}
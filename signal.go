@@ -0,0 +1,54 @@
+package bootloader
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// DefaultSignals are the signals trapped by Launch.
+var DefaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+var exit = os.Exit
+
+// handleSignals traps sig until the returned function is called.
+// SIGHUP reloads the properties and the modules, the first other signal shuts the
+// container down gracefully and the second one exits the process.
+func (loader *bootloader) handleSignals(sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		return func() {}
+	}
+	ch := make(chan os.Signal, 2)
+	done := make(chan struct{})
+	signal.Notify(ch, sig...)
+	go func() {
+		shutdown := false
+		for {
+			select {
+			case s := <-ch:
+				if s == syscall.SIGHUP {
+					loader.log.Println("bootloader: received", s, "reloading")
+					if err := loader.ReloadProperties(); err != nil {
+						loader.log.Println(err)
+					}
+					loader.Reload()
+					continue
+				}
+				if shutdown {
+					loader.log.Println("bootloader: received", s, "again, exiting")
+					exit(1)
+					return
+				}
+				shutdown = true
+				loader.log.Println("bootloader: received", s, "shutting down")
+				loader.Shutdown()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package bootloader
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type reloadModule struct {
+	reloaded chan struct{}
+}
+
+func (m *reloadModule) OnStart(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (m *reloadModule) OnReload(ctx context.Context) error {
+	m.reloaded <- struct{}{}
+	return nil
+}
+
+func Test_Bootloader_Signals(t *testing.T) {
+	loader := newBootloader().(*bootloader)
+	m := &reloadModule{reloaded: make(chan struct{}, 1)}
+	if err := loader.AddByAuto(m); err != nil {
+		t.Fatal(err)
+	}
+	stop := loader.handleSignals(syscall.SIGHUP, syscall.SIGUSR1)
+	defer stop()
+	done := make(chan error, 1)
+	go func() {
+		done <- loader.Wait()
+	}()
+
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(syscall.SIGHUP)
+	select {
+	case <-m.reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("module was not reloaded")
+	}
+
+	p.Signal(syscall.SIGUSR1)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after signal")
+	}
+}
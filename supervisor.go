@@ -0,0 +1,92 @@
+package bootloader
+
+import (
+	"fmt"
+	"time"
+)
+
+type RestartMode int
+
+const (
+	// RestartNever runs the start hook once.
+	RestartNever RestartMode = iota
+	// RestartOnFailure re-runs the start hook when it fails.
+	RestartOnFailure
+	// RestartAlways re-runs the start hook whenever it returns.
+	RestartAlways
+)
+
+// RestartPolicy controls how the start hook of a module is supervised.
+// Backoff is the delay before the first restart, doubled after every
+// restart up to MaxBackoff; it defaults to DefaultRestartBackoff.
+// A MaxRetries of zero allows unlimited restarts.
+type RestartPolicy struct {
+	Mode       RestartMode
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRestartBackoff is the delay before the first restart of a
+// RestartPolicy without Backoff.
+const DefaultRestartBackoff = 100 * time.Millisecond
+
+func (p RestartPolicy) restart(err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+func (p RestartPolicy) next(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// Restart sets the restart policy of the module.
+func Restart(policy RestartPolicy) Option {
+	return func(o *options) {
+		o.restart = policy
+	}
+}
+
+// supervise runs the start hook of m and restarts it according to its
+// policy until the container shuts down. An exhausted restart budget
+// is returned as an error, which shuts the container down.
+func (loader *bootloader) supervise(m *wrappedModule) error {
+	policy := m.opts.restart
+	err := m.Start(loader.ctx)
+	backoff := policy.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRestartBackoff
+	}
+	for policy.restart(err) {
+		if policy.MaxRetries > 0 && m.Restarts() >= policy.MaxRetries {
+			if err == nil {
+				err = fmt.Errorf("start hook returned")
+			}
+			return &ModuleError{Path: m.Path(), Phase: PhaseStart,
+				Err: fmt.Errorf("restart budget of %d exhausted: %w", policy.MaxRetries, err)}
+		}
+		if err != nil {
+			loader.log.Println(err)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-loader.ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		backoff = policy.next(backoff)
+		loader.log.Println("bootloader: restart", m.Path())
+		err = m.Restart(loader.ctx)
+	}
+	return err
+}
@@ -1,5 +1,7 @@
 package bootloader
 
+import "strings"
+
 // isShellSpecialVar reports whether the character identifies a special
 // shell variable such as $*.
 func isShellSpecialVar(c uint8) bool {
@@ -40,3 +42,46 @@ func getShellName(s string) (string, int) {
 	}
 	return s[:i], i
 }
+
+// parsePropertyKey parses the property reference following '$' in a
+// struct tag: "name", "{name}" or "{name:default}".
+func parsePropertyKey(s string) (name, def string, hasDef bool) {
+	if strings.HasPrefix(s, "{") {
+		s, _ = getShellName(s)
+	}
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		return strings.TrimSpace(s[:i]), s[i+1:], true
+	}
+	return strings.TrimSpace(s), "", false
+}
+
+// parseTag splits a struct tag such as "auto,qualifier=replica" or
+// "${server.port:8080},optional" into its key and options. Options
+// without a value map to "true".
+func parseTag(tag string) (string, map[string]string) {
+	tag = strings.TrimSpace(tag)
+	key, rest := tag, ""
+	i := 0
+	if strings.HasPrefix(tag, "${") {
+		// the key may contain commas in its default value
+		if j := strings.IndexByte(tag, '}'); j > 0 {
+			i = j
+		}
+	}
+	if j := strings.IndexByte(tag[i:], ','); j >= 0 {
+		key, rest = tag[:i+j], tag[i+j+1:]
+	}
+	opts := make(map[string]string)
+	for _, opt := range strings.Split(rest, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+		if j := strings.IndexByte(opt, '='); j >= 0 {
+			opts[strings.TrimSpace(opt[:j])] = strings.TrimSpace(opt[j+1:])
+		} else {
+			opts[opt] = "true"
+		}
+	}
+	return strings.TrimSpace(key), opts
+}
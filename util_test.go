@@ -0,0 +1,28 @@
+package bootloader
+
+import "testing"
+
+func Test_ParseTag(t *testing.T) {
+	cases := []struct {
+		tag  string
+		key  string
+		opts map[string]string
+	}{
+		{"auto", "auto", map[string]string{}},
+		{"auto,qualifier=replica", "auto", map[string]string{"qualifier": "replica"}},
+		{"cache, optional", "cache", map[string]string{"optional": "true"}},
+		{"${servers:a,b},optional", "${servers:a,b}", map[string]string{"optional": "true"}},
+	}
+	for _, c := range cases {
+		key, opts := parseTag(c.tag)
+		if key != c.key || len(opts) != len(c.opts) {
+			t.Errorf("%q: got %q %v", c.tag, key, opts)
+			continue
+		}
+		for k, v := range c.opts {
+			if opts[k] != v {
+				t.Errorf("%q: option %s got %q expected %q", c.tag, k, opts[k], v)
+			}
+		}
+	}
+}
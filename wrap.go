@@ -1,10 +1,15 @@
 package bootloader
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime/debug"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -17,10 +22,47 @@ const (
 	statusStarted
 	statusDestroying
 	statusDestroyed
+	statusFailed
 )
 
+// Status is the lifecycle status of a module.
+type Status int32
+
+const (
+	StatusInitial    = Status(statusInitial)
+	StatusCreating   = Status(statusCreating)
+	StatusCreated    = Status(statusCreated)
+	StatusMounting   = Status(statusMounting)
+	StatusMounted    = Status(statusMounted)
+	StatusStarting   = Status(statusStarting)
+	StatusStarted    = Status(statusStarted)
+	StatusDestroying = Status(statusDestroying)
+	StatusDestroyed  = Status(statusDestroyed)
+	StatusFailed     = Status(statusFailed)
+)
+
+var statusNames = [...]string{
+	statusInitial:    "initial",
+	statusCreating:   "creating",
+	statusCreated:    "created",
+	statusMounting:   "mounting",
+	statusMounted:    "mounted",
+	statusStarting:   "starting",
+	statusStarted:    "started",
+	statusDestroying: "destroying",
+	statusDestroyed:  "destroyed",
+	statusFailed:     "failed",
+}
+
+func (s Status) String() string {
+	if s >= 0 && int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return fmt.Sprintf("Status(%d)", int32(s))
+}
+
 func newWrappedModule(i interface{}) *wrappedModule {
-	m := &wrappedModule{}
+	m := &wrappedModule{opts: &options{}, superviseDone: make(chan struct{})}
 	m.rv = reflect.ValueOf(i)
 	m.rt = m.rv.Type()
 	m.status = statusInitial
@@ -29,11 +71,16 @@ func newWrappedModule(i interface{}) *wrappedModule {
 }
 
 type wrappedField struct {
-	injected bool
-	name     string
-	tag      string
-	rt       reflect.Type
-	rv       reflect.Value
+	injected  bool
+	name      string
+	tag       string
+	key       string
+	qualifier string
+	optional  bool
+	static    bool
+	rt        reflect.Type
+	rv        reflect.Value
+	deps      []*wrappedModule
 }
 
 func (wrapped *wrappedField) SetValue(v reflect.Value) {
@@ -41,27 +88,70 @@ func (wrapped *wrappedField) SetValue(v reflect.Value) {
 	wrapped.injected = true
 }
 
+func (wrapped *wrappedField) SetModule(m *wrappedModule) {
+	wrapped.SetModules(m.rv, []*wrappedModule{m})
+}
+
+// SetModules sets v, built from the modules ms, as the value of the field.
+func (wrapped *wrappedField) SetModules(v reflect.Value, ms []*wrappedModule) {
+	wrapped.SetValue(v)
+	wrapped.deps = ms
+}
+
 type wrappedModule struct {
 	injected bool
 	name     string
 	rt       reflect.Type
 	rv       reflect.Value
 	fields   []*wrappedField
+	params   []*wrappedModule
+	provider *provider
 	status   int32
-	log      Logger
+	// startFailed is set while m is failed in PhaseStart
+	startFailed int32
+	stopped     int32
+	restarts    int32
+	opts        *options
+	timeouts    *timeouts
+	events      func(Event)
+	shutdown    func() (context.Context, context.CancelFunc)
+	times       [len(statusNames)]int64
+	log         Logger
+
+	stopErr   error
+	stopMutex sync.Mutex
+
+	supervised    int32
+	superviseDone chan struct{}
 }
 
 func (m *wrappedModule) Fields() []*wrappedField {
 	return m.fields
 }
 
+// Dependencies returns the modules injected into m,
+// including the parameters of its provider function.
+func (m *wrappedModule) Dependencies() []*wrappedModule {
+	deps := append([]*wrappedModule(nil), m.params...)
+	for _, f := range m.fields {
+		deps = append(deps, f.deps...)
+	}
+	return deps
+}
+
+func (m *wrappedModule) Injected() bool {
+	return len(m.fields) <= 0 || m.injected
+}
+
+// TryInject reports whether m still waits for a required field, marking
+// it as injected otherwise. Optional fields are not waited for.
 func (m *wrappedModule) TryInject() bool {
 	if len(m.fields) <= 0 || m.injected {
 		return false
 	}
 	need := false
 	for i := len(m.fields) - 1; i >= 0; i-- {
-		need = !m.fields[i].injected
+		need = !m.fields[i].injected && !m.fields[i].optional
 		if need {
 			break
 		}
@@ -70,13 +160,23 @@ func (m *wrappedModule) TryInject() bool {
 	return need
 }
 
+// waitsOptional reports whether an optional field of m is unresolved.
+func (m *wrappedModule) waitsOptional() bool {
+	for _, f := range m.fields {
+		if !f.injected && f.optional {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *wrappedModule) MustInject() {
 	if len(m.fields) <= 0 || m.injected {
 		return
 	}
 	for i := len(m.fields) - 1; i >= 0; i-- {
 		f := m.fields[i]
-		if !f.injected {
+		if !f.injected && !f.optional {
 			panic(fmt.Errorf("bootloader: Module %s, FieldName:%s, The injection was not completed", m.Path(), f.name))
 		}
 	}
@@ -98,11 +198,16 @@ func (m *wrappedModule) travelFields() {
 			ft := rt.Field(i)
 			tag := ft.Tag.Get(structTag)
 			if strings.TrimSpace(tag) != "" {
+				key, opts := parseTag(tag)
 				f := &wrappedField{
-					name: ft.Name,
-					tag:  tag,
-					rt:   ft.Type,
-					rv:   fv,
+					name:      ft.Name,
+					tag:       tag,
+					key:       key,
+					qualifier: opts[structTagQualifier],
+					optional:  opts[structTagOptional] == "true",
+					static:    opts[structTagStatic] == "true",
+					rt:        ft.Type,
+					rv:        fv,
 				}
 				fields = append(fields, f)
 			}
@@ -111,6 +216,20 @@ func (m *wrappedModule) travelFields() {
 	}
 }
 
+// Qualified reports whether m matches qualifier; every module
+// matches the empty qualifier.
+func (m *wrappedModule) Qualified(qualifier string) bool {
+	return qualifier == "" || m.opts.qualifier == qualifier
+}
+
+// Key identifies the module by its name or, if unnamed, its Path.
+func (m *wrappedModule) Key() string {
+	if m.name != "" {
+		return m.name
+	}
+	return m.Path()
+}
+
 func (m *wrappedModule) Path() string {
 	rt := m.rt
 	if rt.Kind() == reflect.Ptr {
@@ -119,54 +238,313 @@ func (m *wrappedModule) Path() string {
 	return rt.PkgPath() + "." + rt.Name()
 }
 
-func (m *wrappedModule) Create() {
-	if !atomic.CompareAndSwapInt32(&m.status, statusInitial, statusCreating) {
-		panic(fmt.Errorf("bootloader: Unable to create Module %s, status %d expected %d", m.Path(), atomic.LoadInt32(&m.status), statusInitial))
+func (m *wrappedModule) Status() int32 {
+	return atomic.LoadInt32(&m.status)
+}
+
+func (m *wrappedModule) Create(ctx context.Context) error {
+	var hook func(context.Context) error
+	switch creater := m.rv.Interface().(type) {
+	case OnCreaterContext:
+		hook = creater.OnCreate
+	case OnCreater:
+		hook = func(context.Context) error {
+			creater.OnCreate()
+			return nil
+		}
+	}
+	return m.transit(ctx, PhaseCreate, statusInitial, statusCreating, statusCreated, hook)
+}
+
+func (m *wrappedModule) Mount(ctx context.Context) error {
+	var hook func(context.Context) error
+	switch mounter := m.rv.Interface().(type) {
+	case OnMounterContext:
+		hook = mounter.OnMount
+	case OnMounter:
+		hook = func(context.Context) error {
+			mounter.OnMount()
+			return nil
+		}
+	}
+	return m.transit(ctx, PhaseMount, statusCreated, statusMounting, statusMounted, hook)
+}
+
+func (m *wrappedModule) Start(ctx context.Context) error {
+	return m.transit(ctx, PhaseStart, statusMounted, statusStarting, statusStarted, m.startHook())
+}
+
+// Restart runs the start hook again after it has returned or failed.
+func (m *wrappedModule) Restart(ctx context.Context) error {
+	from := statusFailed
+	if atomic.LoadInt32(&m.status) == statusStarted {
+		from = statusStarted
+	}
+	atomic.AddInt32(&m.restarts, 1)
+	atomic.StoreInt32(&m.stopped, 0)
+	return m.transit(ctx, PhaseStart, from, statusStarting, statusStarted, m.startHook())
+}
+
+func (m *wrappedModule) Restarts() int {
+	return int(atomic.LoadInt32(&m.restarts))
+}
+
+func (m *wrappedModule) startHook() func(context.Context) error {
+	var hook func(context.Context) error
+	switch starter := m.rv.Interface().(type) {
+	case OnStarterContext:
+		hook = func(ctx context.Context) error {
+			err := starter.OnStart(ctx)
+			if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+				// stopped by the container
+				return nil
+			}
+			return err
+		}
+	case OnStarter:
+		hook = func(context.Context) error {
+			starter.OnStart()
+			return nil
+		}
+	}
+	if _, ok := m.rv.Interface().(OnStopper); ok && hook != nil {
+		hook = m.stopOnDone(hook)
+	}
+	return hook
+}
+
+// Stop asks a module whose start hook is still running to return.
+// It is a no-op for modules that are not starting or have been stopped.
+func (m *wrappedModule) Stop(ctx context.Context) error {
+	stopper, _ := m.rv.Interface().(OnStopper)
+	if stopper == nil || atomic.LoadInt32(&m.status) != statusStarting {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&m.stopped, 0, 1) {
+		return nil
+	}
+	return m.invoke(ctx, PhaseStop, stopper.OnStop)
+}
+
+// Reload runs the reload hook of a starting or started module.
+func (m *wrappedModule) Reload(ctx context.Context) error {
+	reloader, _ := m.rv.Interface().(OnReloader)
+	if reloader == nil {
+		return nil
+	}
+	if status := atomic.LoadInt32(&m.status); status != statusStarting && status != statusStarted {
+		return nil
+	}
+	return m.invoke(ctx, PhaseReload, reloader.OnReload)
+}
+
+// HealthCheck runs the health check of a starting or started module.
+func (m *wrappedModule) HealthCheck(ctx context.Context) error {
+	checker, _ := m.rv.Interface().(OnHealthChecker)
+	if checker == nil {
+		return nil
+	}
+	var err error
+	if status := atomic.LoadInt32(&m.status); status != statusStarting && status != statusStarted {
+		err = ErrNotRunning
+	} else {
+		err = m.call(ctx, PhaseHealthCheck, checker.HealthCheck)
+	}
+	if err != nil {
+		return &ModuleError{Path: m.Path(), Phase: PhaseHealthCheck, Err: err}
+	}
+	return nil
+}
+
+// stopOnDone wraps a start hook so that the module is stopped
+// once ctx is cancelled while the hook is still running. The stop hook
+// is bounded by the shutdown timeout.
+func (m *wrappedModule) stopOnDone(hook func(context.Context) error) func(context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				sctx, cancel := context.WithCancel(context.Background())
+				if m.shutdown != nil {
+					sctx, cancel = m.shutdown()
+				}
+				defer cancel()
+				if err := m.Stop(sctx); err != nil {
+					m.log.Println(err)
+					m.stopMutex.Lock()
+					m.stopErr = err
+					m.stopMutex.Unlock()
+				}
+			case <-done:
+			}
+		}()
+		err := hook(ctx)
+		close(done)
+		<-stopped
+		return err
+	}
+}
+
+// Running reports whether the start hooks of m are supervised and
+// have not returned for good.
+func (m *wrappedModule) Running() bool {
+	if atomic.LoadInt32(&m.supervised) == 0 {
+		return false
+	}
+	select {
+	case <-m.superviseDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// StopErr returns the error of the last stop hook, if it failed.
+func (m *wrappedModule) StopErr() error {
+	m.stopMutex.Lock()
+	defer m.stopMutex.Unlock()
+	return m.stopErr
+}
+
+func (m *wrappedModule) Destroy(ctx context.Context) error {
+	var hook func(context.Context) error
+	switch destroyer := m.rv.Interface().(type) {
+	case OnDestroyerContext:
+		hook = destroyer.OnDestroy
+	case OnDestroyer:
+		hook = func(context.Context) error {
+			destroyer.OnDestroy()
+			return nil
+		}
+	}
+	from := statusStarted
+	if atomic.LoadInt32(&m.status) == statusFailed && atomic.LoadInt32(&m.startFailed) != 0 {
+		from = statusFailed
+	}
+	return m.transit(ctx, PhaseDestroy, from, statusDestroying, statusDestroyed, hook)
+}
+
+// Destroyable reports whether m is started or failed in its start hook,
+// its create and mount hooks having succeeded.
+func (m *wrappedModule) Destroyable() bool {
+	switch atomic.LoadInt32(&m.status) {
+	case statusStarted:
+		return true
+	case statusFailed:
+		return atomic.LoadInt32(&m.startFailed) != 0
+	}
+	return false
+}
+
+// transit moves the module from status from to done through doing,
+// running hook in between. A failed hook leaves the module in statusFailed.
+func (m *wrappedModule) transit(ctx context.Context, phase Phase, from, doing, done int32, hook func(context.Context) error) error {
+	if !atomic.CompareAndSwapInt32(&m.status, from, doing) {
+		return fmt.Errorf("bootloader: Unable to %s Module %s, status %s expected %s", phase, m.Path(), Status(atomic.LoadInt32(&m.status)), Status(from))
 	}
-	creater, _ := m.rv.Interface().(OnCreater)
-	if creater != nil {
-		m.log.Printf("bootloader: create %s begin", m.Path())
-		creater.OnCreate()
-		m.log.Printf("bootloader: create %s end", m.Path())
+	m.record(phase, from, doing, 0, nil)
+	begin := time.Now()
+	if hook != nil {
+		if err := m.invoke(ctx, phase, hook); err != nil {
+			if phase == PhaseStart {
+				atomic.StoreInt32(&m.startFailed, 1)
+			}
+			atomic.StoreInt32(&m.status, statusFailed)
+			m.record(phase, doing, statusFailed, time.Since(begin), err)
+			return err
+		}
 	}
-	atomic.StoreInt32(&m.status, statusCreated)
+	atomic.StoreInt32(&m.startFailed, 0)
+	atomic.StoreInt32(&m.status, done)
+	m.record(phase, doing, done, time.Since(begin), nil)
+	return nil
 }
 
-func (m *wrappedModule) Mount() {
-	if !atomic.CompareAndSwapInt32(&m.status, statusCreated, statusMounting) {
-		panic(fmt.Errorf("bootloader: Unable to mount Module %s, status %d expected %d", m.Path(), atomic.LoadInt32(&m.status), statusCreated))
+// record stamps the transition to status to and publishes it.
+func (m *wrappedModule) record(phase Phase, from, to int32, d time.Duration, err error) {
+	now := time.Now()
+	atomic.StoreInt64(&m.times[to], now.UnixNano())
+	if m.events == nil {
+		return
 	}
-	mounter, _ := m.rv.Interface().(OnMounter)
-	if mounter != nil {
-		m.log.Printf("bootloader: mount %s begin", m.Path())
-		mounter.OnMount()
-		m.log.Printf("bootloader: mount %s end", m.Path())
+	m.events(Event{
+		Name:     m.name,
+		Path:     m.Path(),
+		Phase:    phase,
+		From:     Status(from),
+		To:       Status(to),
+		Time:     now,
+		Duration: d,
+		Err:      err,
+	})
+}
+
+// Transitions returns the time of the last transition to each status.
+func (m *wrappedModule) Transitions() map[Status]time.Time {
+	times := make(map[Status]time.Time)
+	for i := range m.times {
+		if t := atomic.LoadInt64(&m.times[i]); t != 0 {
+			times[Status(i)] = time.Unix(0, t)
+		}
 	}
-	atomic.StoreInt32(&m.status, statusMounted)
+	return times
 }
 
-func (m *wrappedModule) Start() {
-	if !atomic.CompareAndSwapInt32(&m.status, statusMounted, statusStarting) {
-		panic(fmt.Errorf("bootloader: Unable to start Module %s, status %d expected %d", m.Path(), atomic.LoadInt32(&m.status), statusMounted))
+// invoke runs the hook of phase and wraps its error into a ModuleError.
+func (m *wrappedModule) invoke(ctx context.Context, phase Phase, hook func(context.Context) error) error {
+	m.log.Printf("bootloader: %s %s begin", phase, m.Path())
+	err := m.call(ctx, phase, hook)
+	m.log.Printf("bootloader: %s %s end", phase, m.Path())
+	if err != nil {
+		return &ModuleError{Path: m.Path(), Phase: phase, Err: err}
 	}
-	starter, _ := m.rv.Interface().(OnStarter)
-	if starter != nil {
-		m.log.Printf("bootloader: start %s begin", m.Path())
-		starter.OnStart()
-		m.log.Printf("bootloader: start %s end", m.Path())
+	return nil
+}
+
+// call runs hook bounded by the timeout of phase. A hook that times out
+// is abandoned: its context is cancelled but it keeps running.
+func (m *wrappedModule) call(ctx context.Context, phase Phase, hook func(context.Context) error) error {
+	d := m.Timeout(phase)
+	if d <= 0 {
+		return safeCall(ctx, hook)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- safeCall(ctx, hook)
+	}()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%w after %s", ErrTimeout, d)
 	}
-	atomic.StoreInt32(&m.status, statusStarted)
 }
 
-func (m *wrappedModule) Destroy() {
-	if !atomic.CompareAndSwapInt32(&m.status, statusStarted, statusDestroying) {
-		panic(fmt.Errorf("bootloader: Unable to destroy Module %s, status %d expected %d", m.Path(), atomic.LoadInt32(&m.status), statusStarted))
+// safeCall runs hook, converting a panic into a *PanicError.
+func safeCall(ctx context.Context, hook func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return hook(ctx)
+}
+
+// Timeout returns the timeout of phase, preferring the module option
+// over the container default.
+func (m *wrappedModule) Timeout(phase Phase) time.Duration {
+	if d, ok := m.opts.timeouts[phase]; ok {
+		return d
 	}
-	destroyer, _ := m.rv.Interface().(OnDestroyer)
-	if destroyer != nil {
-		m.log.Printf("bootloader: destroy %s begin", m.Path())
-		destroyer.OnDestroy()
-		m.log.Printf("bootloader: destroy %s end", m.Path())
+	if m.timeouts != nil {
+		return m.timeouts.get(phase)
 	}
-	atomic.StoreInt32(&m.status, statusDestroyed)
+	return 0
 }